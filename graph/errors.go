@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"log"
+	"ozon-graphql-api/internal/apperr"
+)
+
+// ErrorPresenter кладет вид доменной ошибки в extensions.code. Внутренние ошибки (база, драйвер,
+// паники) пишутся в лог, а клиент видит только "internal error". Ошибки ввода
+// дополнительно перечисляют нарушенные правила в extensions.fields.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	//gqlgen оборачивает ошибки резолверов в gqlerror с путем поля. Ошибки разбора,
+	//валидации и лимитов он формирует сам, без Err - их коды не трогаем
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) && gqlErr.Err == nil {
+		return gqlErr
+	}
+
+	presented := graphql.DefaultErrorPresenter(ctx, err)
+
+	kind := apperr.KindOf(err)
+	if kind == apperr.Internal {
+		log.Printf("internal error at %s: %v", presented.Path, err)
+	}
+	presented.Message = apperr.Message(err)
+
+	presented = withCode(presented, kind)
+	if fields := apperr.FieldsOf(err); len(fields) > 0 {
+		presented.Extensions["fields"] = fields
+	}
+
+	return presented
+}
+
+func withCode(err *gqlerror.Error, kind apperr.Kind) *gqlerror.Error {
+	if err.Extensions == nil {
+		err.Extensions = make(map[string]interface{})
+	}
+	err.Extensions["code"] = string(kind)
+	return err
+}
@@ -0,0 +1,72 @@
+package model
+
+import "time"
+
+// Post, Comment и User описаны вручную: связанные списки в схеме отдаются
+// постранично через резолверы, а в структурах хранятся только сами данные.
+
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type Post struct {
+	ID                    string     `json:"id"`
+	Title                 string     `json:"title"`
+	Text                  string     `json:"text"`
+	CreatedBy             *User      `json:"createdBy"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	IsCommentingAvailable bool       `json:"isCommentingAvailable"`
+	EditedAt              *time.Time `json:"editedAt,omitempty"`
+	DeletedAt             *time.Time `json:"deletedAt,omitempty"`
+	Upvotes               int        `json:"upvotes"`
+	Downvotes             int        `json:"downvotes"`
+}
+
+func (p Post) Score() int {
+	return p.Upvotes - p.Downvotes
+}
+
+func (Post) IsSearchNode() {}
+
+type Comment struct {
+	ID        string     `json:"id"`
+	PostID    string     `json:"postId"`
+	Sender    *User      `json:"sender"`
+	ReplyTo   *Comment   `json:"replyTo,omitempty"`
+	Text      string     `json:"text"`
+	CreatedAt time.Time  `json:"createdAt"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	Upvotes   int        `json:"upvotes"`
+	Downvotes int        `json:"downvotes"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+func (c Comment) Score() int {
+	return c.Upvotes - c.Downvotes
+}
+
+func (Comment) IsCommentThreadEvent() {}
+
+func (Comment) IsSearchNode() {}
+
+// DeletedText заменяет текст удаленных постов и комментариев, у которых остались ответы:
+// запись остается в дереве, чтобы не терялась структура обсуждения.
+const DeletedText = "[deleted]"
+
+// В NewPost и NewComment автор заполняется резолвером из токена, значение от клиента игнорируется.
+
+type NewPost struct {
+	Title                 string `json:"title"`
+	Text                  string `json:"text"`
+	IsCommentingAvailable *bool  `json:"isCommentingAvailable,omitempty"`
+	UserID                string `json:"userId"`
+}
+
+type NewComment struct {
+	PostID   string  `json:"postID"`
+	SenderID string  `json:"senderID"`
+	ReplyTo  *string `json:"replyTo,omitempty"`
+	Text     string  `json:"text"`
+}
@@ -2,50 +2,286 @@
 
 package model
 
-type Comment struct {
-	ID        string     `json:"id"`
-	PostID    string     `json:"postId"`
-	Sender    *User      `json:"sender"`
-	ReplyTo   *Comment   `json:"replyTo,omitempty"`
-	Text      string     `json:"text"`
-	CreatedAt string     `json:"createdAt"`
-	Replies   []*Comment `json:"replies,omitempty"`
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type CommentThreadEvent interface {
+	IsCommentThreadEvent()
+}
+
+type SearchNode interface {
+	IsSearchNode()
+}
+
+type CommentConnection struct {
+	Edges    []*CommentEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type CommentEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Comment `json:"node"`
+}
+
+type CommentingAvailabilityChanged struct {
+	PostID                string `json:"postId"`
+	IsCommentingAvailable bool   `json:"isCommentingAvailable"`
+}
+
+func (CommentingAvailabilityChanged) IsCommentThreadEvent() {}
+
+// Интервал времени создания: from включительно, to не включительно. Любая граница может быть опущена
+type DateRange struct {
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
 }
 
 type Mutation struct {
 }
 
-type NewComment struct {
-	PostID   string  `json:"postID"`
-	SenderID string  `json:"senderID"`
-	ReplyTo  *string `json:"replyTo,omitempty"`
-	Text     string  `json:"text"`
+type NewUser struct {
+	Username string `json:"username"`
+}
+
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
 }
 
-type NewPost struct {
-	Title                 string `json:"title"`
-	Text                  string `json:"text"`
-	IsCommentingAvailable *bool  `json:"isCommentingAvailable,omitempty"`
-	UserID                string `json:"userId"`
+type PostConnection struct {
+	Edges    []*PostEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
 }
 
-type Post struct {
-	ID                    string     `json:"id"`
-	Title                 string     `json:"title"`
-	Text                  string     `json:"text"`
-	CreatedBy             *User      `json:"createdBy"`
-	CreatedAt             string     `json:"createdAt"`
-	IsCommentingAvailable bool       `json:"isCommentingAvailable"`
-	Comments              []*Comment `json:"comments,omitempty"`
+type PostEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Post  `json:"node"`
 }
 
 type Query struct {
 }
 
+type SearchConnection struct {
+	Edges    []*SearchEdge `json:"edges"`
+	PageInfo *PageInfo     `json:"pageInfo"`
+}
+
+type SearchEdge struct {
+	Cursor string     `json:"cursor"`
+	Node   *SearchHit `json:"node"`
+}
+
+type SearchHit struct {
+	Node    SearchNode `json:"node"`
+	Rank    float64    `json:"rank"`
+	Snippet string     `json:"snippet"`
+}
+
 type Subscription struct {
 }
 
-type User struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+type UpdatePost struct {
+	Title *string `json:"title,omitempty"`
+	Text  *string `json:"text,omitempty"`
+}
+
+type UserConnection struct {
+	Edges    []*UserEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type UserEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *User  `json:"node"`
+}
+
+type VoteResult struct {
+	TargetType VoteTarget `json:"targetType"`
+	TargetID   string     `json:"targetId"`
+	Score      int        `json:"score"`
+	Upvotes    int        `json:"upvotes"`
+	Downvotes  int        `json:"downvotes"`
+	MyVote     int        `json:"myVote"`
+}
+
+type CommentSort string
+
+const (
+	CommentSortNew           CommentSort = "NEW"
+	CommentSortOld           CommentSort = "OLD"
+	CommentSortTop           CommentSort = "TOP"
+	CommentSortHot           CommentSort = "HOT"
+	CommentSortControversial CommentSort = "CONTROVERSIAL"
+)
+
+var AllCommentSort = []CommentSort{
+	CommentSortNew,
+	CommentSortOld,
+	CommentSortTop,
+	CommentSortHot,
+	CommentSortControversial,
+}
+
+func (e CommentSort) IsValid() bool {
+	switch e {
+	case CommentSortNew, CommentSortOld, CommentSortTop, CommentSortHot, CommentSortControversial:
+		return true
+	}
+	return false
+}
+
+func (e CommentSort) String() string {
+	return string(e)
+}
+
+func (e *CommentSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CommentSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CommentSort", str)
+	}
+	return nil
+}
+
+func (e CommentSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PostSort string
+
+const (
+	PostSortNew           PostSort = "NEW"
+	PostSortOld           PostSort = "OLD"
+	PostSortTop           PostSort = "TOP"
+	PostSortHot           PostSort = "HOT"
+	PostSortControversial PostSort = "CONTROVERSIAL"
+)
+
+var AllPostSort = []PostSort{
+	PostSortNew,
+	PostSortOld,
+	PostSortTop,
+	PostSortHot,
+	PostSortControversial,
+}
+
+func (e PostSort) IsValid() bool {
+	switch e {
+	case PostSortNew, PostSortOld, PostSortTop, PostSortHot, PostSortControversial:
+		return true
+	}
+	return false
+}
+
+func (e PostSort) String() string {
+	return string(e)
+}
+
+func (e *PostSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PostSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PostSort", str)
+	}
+	return nil
+}
+
+func (e PostSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SearchType string
+
+const (
+	SearchTypeAll      SearchType = "ALL"
+	SearchTypePosts    SearchType = "POSTS"
+	SearchTypeComments SearchType = "COMMENTS"
+)
+
+var AllSearchType = []SearchType{
+	SearchTypeAll,
+	SearchTypePosts,
+	SearchTypeComments,
+}
+
+func (e SearchType) IsValid() bool {
+	switch e {
+	case SearchTypeAll, SearchTypePosts, SearchTypeComments:
+		return true
+	}
+	return false
+}
+
+func (e SearchType) String() string {
+	return string(e)
+}
+
+func (e *SearchType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SearchType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchType", str)
+	}
+	return nil
+}
+
+func (e SearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type VoteTarget string
+
+const (
+	VoteTargetPost    VoteTarget = "POST"
+	VoteTargetComment VoteTarget = "COMMENT"
+)
+
+var AllVoteTarget = []VoteTarget{
+	VoteTargetPost,
+	VoteTargetComment,
+}
+
+func (e VoteTarget) IsValid() bool {
+	switch e {
+	case VoteTargetPost, VoteTargetComment:
+		return true
+	}
+	return false
+}
+
+func (e VoteTarget) String() string {
+	return string(e)
+}
+
+func (e *VoteTarget) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = VoteTarget(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid VoteTarget", str)
+	}
+	return nil
+}
+
+func (e VoteTarget) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
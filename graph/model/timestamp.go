@@ -0,0 +1,40 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"ozon-graphql-api/internal/apperr"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// Скаляр Timestamp - time.Time в формате RFC3339Nano в UTC, независимо от хранилища
+// и часового пояса сервера. На вход принимается RFC3339 с любым смещением.
+
+func MarshalTimestamp(t time.Time) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		_, _ = io.WriteString(w, strconv.Quote(FormatTimestamp(t)))
+	})
+}
+
+func UnmarshalTimestamp(v interface{}) (time.Time, error) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, apperr.New(apperr.Validation, fmt.Sprintf("timestamp should be an RFC3339 string, got %T", v))
+	}
+	return ParseTimestamp(s)
+}
+
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func ParseTimestamp(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, apperr.Wrap(apperr.Validation, err, fmt.Sprintf("timestamp %q should be in RFC3339 format", s))
+	}
+	return t.UTC(), nil
+}
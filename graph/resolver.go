@@ -1,18 +1,72 @@
 package graph
 
 import (
+	"context"
 	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/loaders"
 	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/service"
+	"ozon-graphql-api/internal/validation"
+	"ozon-graphql-api/pkg/pubsub"
 )
 
 type Resolver struct {
-	Repos       *repository.Repository
-	Subscribers map[string]chan *model.Comment
+	Repos *repository.Repository
+	//События обсуждения рассылаются подписчикам commentAdded, топик - id поста
+	CommentBroker *pubsub.Broker[model.CommentThreadEvent]
+	//Мутации идут через сервисы с правилами, чтение - напрямую в репозитории
+	Users     *service.UserService
+	Posts     *service.PostService
+	Comments  *service.CommentService
+	Votes     *service.VoteService
+	Validator *validation.Validator
 }
 
-func NewResolver(repos *repository.Repository) *Resolver {
+func NewResolver(repos *repository.Repository, validator *validation.Validator) *Resolver {
 	return &Resolver{
-		Repos:       repos,
-		Subscribers: make(map[string]chan *model.Comment),
+		Repos:         repos,
+		CommentBroker: pubsub.NewBroker[model.CommentThreadEvent](pubsub.DefaultBufferSize, pubsub.DropMessage),
+		Users:         service.NewUserService(repos, validator),
+		Posts:         service.NewPostService(repos, validator),
+		Comments:      service.NewCommentService(repos, validator),
+		Votes:         service.NewVoteService(repos, validator),
+		Validator:     validator,
 	}
 }
+
+// ListenCommentEvents пересылает события обсуждения (в том числе от других экземпляров сервиса)
+// локальным подписчикам commentAdded, пока не отменен ctx.
+func (r *Resolver) ListenCommentEvents(ctx context.Context) error {
+	return r.Repos.CommentEvents.Listen(ctx, func(postID string, event model.CommentThreadEvent) {
+		r.CommentBroker.Publish(postID, event)
+	})
+}
+
+// loadersFor возвращает загрузчики запроса. У подписок их нет, для каждого поля создаются новые.
+func (r *Resolver) loadersFor(ctx context.Context) *loaders.Loaders {
+	if l := loaders.For(ctx); l != nil {
+		return l
+	}
+	return loaders.New(r.Repos)
+}
+
+// author: репозитории уже подтягивают имя автора через JOIN, поэтому в загрузчик
+// идем только за пользователями, у которых известен один id.
+func (r *Resolver) author(ctx context.Context, user *model.User) (*model.User, error) {
+	if user == nil {
+		return nil, repository.ErrUserNotFound
+	}
+	if user.Username != "" {
+		return user, nil
+	}
+
+	found, err := r.loadersFor(ctx).User(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, repository.ErrUserNotFound
+	}
+
+	return found, nil
+}
@@ -7,32 +7,160 @@ package graph
 import (
 	"context"
 	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/auth"
 )
 
+// Sender is the resolver for the sender field.
+func (r *commentResolver) Sender(ctx context.Context, obj *model.Comment) (*model.User, error) {
+	return r.author(ctx, obj.Sender)
+}
+
+// ReplyTo is the resolver for the replyTo field.
+func (r *commentResolver) ReplyTo(ctx context.Context, obj *model.Comment) (*model.Comment, error) {
+	if obj.ReplyTo == nil {
+		return nil, nil
+	}
+
+	return r.loadersFor(ctx).Comment(ctx, obj.ReplyTo.ID)
+}
+
+// MyVote is the resolver for the myVote field.
+func (r *commentResolver) MyVote(ctx context.Context, obj *model.Comment) (int, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return 0, nil
+	}
+
+	return r.Repos.VoteRepository.MyVote(ctx, model.VoteTargetComment, obj.ID, user.ID)
+}
+
+// Replies is the resolver for the replies field.
+func (r *commentResolver) Replies(ctx context.Context, obj *model.Comment, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	return r.loadersFor(ctx).RepliesByComment(ctx, obj.ID, sort, first, after)
+}
+
+// CreateUser is the resolver for the createUser field.
+func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser) (*model.User, error) {
+	return r.Users.CreateUser(ctx, input)
+}
+
 // CreatePost is the resolver for the createPost field.
 func (r *mutationResolver) CreatePost(ctx context.Context, input model.NewPost) (*model.Post, error) {
-	return r.Repos.PostRepository.CreatePost(ctx, input)
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	input.UserID = user.ID
+
+	return r.Posts.CreatePost(ctx, input)
+}
+
+// UpdatePost is the resolver for the updatePost field.
+func (r *mutationResolver) UpdatePost(ctx context.Context, id string, input model.UpdatePost) (*model.Post, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Posts.UpdatePost(ctx, id, user.ID, input)
+}
+
+// DeletePost is the resolver for the deletePost field.
+func (r *mutationResolver) DeletePost(ctx context.Context, id string) (bool, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.Posts.DeletePost(ctx, id, user.ID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetCommentingAvailable is the resolver for the setCommentingAvailable field.
+func (r *mutationResolver) SetCommentingAvailable(ctx context.Context, postID string, available bool) (*model.Post, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Posts.SetCommentingAvailable(ctx, postID, user.ID, available)
 }
 
 // CreateComment is the resolver for the createComment field.
 func (r *mutationResolver) CreateComment(ctx context.Context, input model.NewComment) (*model.Comment, error) {
-	comment, err := r.Repos.CommentRepository.CreateComment(ctx, input)
+	user, err := auth.RequireUser(ctx)
 	if err != nil {
 		return nil, err
 	}
+	input.SenderID = user.ID
+
+	//Подписчики получат комментарий через CommentEvents, см. Resolver.ListenCommentEvents
+	return r.Comments.CreateComment(ctx, input)
+}
 
-	if channel, found := r.Subscribers[input.PostID]; found {
-		go func() {
-			channel <- comment
-		}()
+// UpdateComment is the resolver for the updateComment field.
+func (r *mutationResolver) UpdateComment(ctx context.Context, id string, text string) (*model.Comment, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return comment, nil
+	return r.Comments.UpdateComment(ctx, id, user.ID, text)
+}
+
+// DeleteComment is the resolver for the deleteComment field.
+func (r *mutationResolver) DeleteComment(ctx context.Context, id string) (bool, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.Comments.DeleteComment(ctx, id, user.ID); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Vote is the resolver for the vote field.
+func (r *mutationResolver) Vote(ctx context.Context, targetType model.VoteTarget, targetID string, value int) (*model.VoteResult, error) {
+	user, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Votes.Vote(ctx, targetType, targetID, user.ID, value)
+}
+
+// CreatedBy is the resolver for the createdBy field.
+func (r *postResolver) CreatedBy(ctx context.Context, obj *model.Post) (*model.User, error) {
+	return r.author(ctx, obj.CreatedBy)
+}
+
+// MyVote is the resolver for the myVote field.
+func (r *postResolver) MyVote(ctx context.Context, obj *model.Post) (int, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return 0, nil
+	}
+
+	return r.Repos.VoteRepository.MyVote(ctx, model.VoteTargetPost, obj.ID, user.ID)
+}
+
+// Comments is the resolver for the comments field.
+func (r *postResolver) Comments(ctx context.Context, obj *model.Post, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	return r.loadersFor(ctx).CommentsByPost(ctx, obj.ID, sort, first, after)
 }
 
 // Posts is the resolver for the posts field.
-func (r *queryResolver) Posts(ctx context.Context, limit *int, offset *int) ([]*model.Post, error) {
-	return r.Repos.PostRepository.Posts(ctx, limit, offset)
+func (r *queryResolver) Posts(ctx context.Context, sort model.PostSort, createdAt *model.DateRange, first *int, after *string) (*model.PostConnection, error) {
+	if err := r.Validator.DateRange("createdAt", createdAt); err != nil {
+		return nil, err
+	}
+	return r.Repos.PostRepository.Posts(ctx, sort, createdAt, first, after)
 }
 
 // PostByID is the resolver for the postById field.
@@ -41,35 +169,72 @@ func (r *queryResolver) PostByID(ctx context.Context, id int) (*model.Post, erro
 }
 
 // Comments is the resolver for the comments field.
-func (r *queryResolver) Comments(ctx context.Context, limit *int, offset *int) ([]*model.Comment, error) {
-	return r.Repos.CommentRepository.Comments(ctx, limit, offset)
+func (r *queryResolver) Comments(ctx context.Context, sort model.CommentSort, createdAt *model.DateRange, first *int, after *string) (*model.CommentConnection, error) {
+	if err := r.Validator.DateRange("createdAt", createdAt); err != nil {
+		return nil, err
+	}
+	return r.Repos.CommentRepository.Comments(ctx, sort, createdAt, first, after)
 }
 
-// CommentAdded is the resolver for the commentAdded field.
-func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
-	commentChannel := make(chan *model.Comment)
+// Search is the resolver for the search field.
+func (r *queryResolver) Search(ctx context.Context, query string, typeArg model.SearchType, createdAt *model.DateRange, first *int, after *string) (*model.SearchConnection, error) {
+	if err := r.Validator.DateRange("createdAt", createdAt); err != nil {
+		return nil, err
+	}
+	return r.Repos.SearchRepository.Search(ctx, query, typeArg, createdAt, first, after)
+}
 
-	// Добавляем канал в список подписчиков
-	r.Subscribers[postID] = commentChannel
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
+	return r.Repos.UserRepository.UserByID(ctx, id)
+}
 
-	go func() {
-		<-ctx.Done()
-		delete(r.Subscribers, postID)
-		close(commentChannel)
-	}()
+// UserByUsername is the resolver for the userByUsername field.
+func (r *queryResolver) UserByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.Repos.UserRepository.UserByUsername(ctx, username)
+}
 
-	return commentChannel, nil
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, first *int, after *string) (*model.UserConnection, error) {
+	return r.Repos.UserRepository.Users(ctx, first, after)
 }
 
+// CommentAdded is the resolver for the commentAdded field.
+func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan model.CommentThreadEvent, error) {
+	return r.CommentBroker.Subscribe(ctx, postID), nil
+}
+
+// Posts is the resolver for the posts field.
+func (r *userResolver) Posts(ctx context.Context, obj *model.User, first *int, after *string) (*model.PostConnection, error) {
+	return r.Repos.PostRepository.PostsByUser(ctx, obj.ID, first, after)
+}
+
+// Comments is the resolver for the comments field.
+func (r *userResolver) Comments(ctx context.Context, obj *model.User, first *int, after *string) (*model.CommentConnection, error) {
+	return r.Repos.CommentRepository.CommentsByUser(ctx, obj.ID, first, after)
+}
+
+// Comment returns CommentResolver implementation.
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Post returns PostResolver implementation.
+func (r *Resolver) Post() PostResolver { return &postResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type commentResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type postResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
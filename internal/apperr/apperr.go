@@ -0,0 +1,104 @@
+package apperr
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kind - вид доменной ошибки. Значение уходит клиенту в extensions.code,
+// а сам Kind служит сентинелом: errors.Is(err, apperr.NotFound).
+type Kind string
+
+const (
+	NotFound        Kind = "NOT_FOUND"
+	Forbidden       Kind = "FORBIDDEN"
+	Unauthenticated Kind = "UNAUTHENTICATED"
+	Validation      Kind = "VALIDATION_FAILED"
+	Conflict        Kind = "CONFLICT"
+	Internal        Kind = "INTERNAL"
+)
+
+func (k Kind) Error() string {
+	return strings.ToLower(strings.ReplaceAll(string(k), "_", " "))
+}
+
+// Error - ошибка с видом и сообщением для клиента. Err - исходная причина, клиенту не показывается.
+// Fields перечисляет нарушенные правила ввода, если ошибка относится к конкретным полям.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+	Fields  []FieldError
+}
+
+// FieldError - нарушенное правило для одного поля ввода.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func Wrap(kind Kind, err error, message string) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// Invalid собирает все нарушения ввода в одну ошибку вида Validation.
+func Invalid(fields []FieldError) *Error {
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return &Error{
+		Kind:    Validation,
+		Message: "invalid input: " + strings.Join(messages, "; "),
+		Fields:  fields,
+	}
+}
+
+// FieldsOf возвращает нарушения ввода из ошибки вида Validation.
+func FieldsOf(err error) []FieldError {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// KindOf возвращает вид ошибки. Все, что не размечено доменным видом (ошибки базы, драйвера,
+// сети), считается внутренней ошибкой.
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+	return Internal
+}
+
+// Message возвращает текст, который можно показать клиенту: у внутренних ошибок он скрыт.
+func Message(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) && appErr.Kind != Internal {
+		return appErr.Error()
+	}
+	return "internal error"
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"os"
+	"ozon-graphql-api/internal/apperr"
+	"strings"
+)
+
+var (
+	ErrUnauthenticated = apperr.New(apperr.Unauthenticated, "unauthenticated")
+	ErrInvalidToken    = apperr.New(apperr.Unauthenticated, "invalid token")
+)
+
+type Config struct {
+	// HS256Secret - общий секрет для токенов, подписанных HS256
+	HS256Secret string
+	// RS256PublicKeyFile - путь к PEM с публичным ключом для токенов, подписанных RS256
+	RS256PublicKeyFile string
+}
+
+// User - автор запроса, id берется из claim sub токена.
+type User struct {
+	ID string
+}
+
+type contextKey struct{}
+
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*User)
+	return user, ok && user != nil
+}
+
+// RequireUser возвращает ErrUnauthenticated для анонимных запросов.
+func RequireUser(ctx context.Context) (*User, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return user, nil
+}
+
+type Authenticator struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	methods    []string
+}
+
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	a := &Authenticator{}
+
+	if cfg.HS256Secret != "" {
+		a.hmacSecret = []byte(cfg.HS256Secret)
+		a.methods = append(a.methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if cfg.RS256PublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.RS256PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading RS256 public key: %w", err)
+		}
+
+		a.rsaKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing RS256 public key: %w", err)
+		}
+		a.methods = append(a.methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	return a, nil
+}
+
+// Enabled сообщает, настроен ли хотя бы один ключ. Без ключей все запросы анонимные.
+func (a *Authenticator) Enabled() bool {
+	return len(a.methods) > 0
+}
+
+func (a *Authenticator) Verify(tokenString string) (*User, error) {
+	if !a.Enabled() {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := jwt.Parse(tokenString, a.key,
+		jwt.WithValidMethods(a.methods),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	subject, err := token.Claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return &User{ID: subject}, nil
+}
+
+// key выбирает ключ по алгоритму токена, алгоритм уже проверен через WithValidMethods.
+func (a *Authenticator) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return a.hmacSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		return a.rsaKey, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+// Middleware кладет пользователя в контекст, если передан заголовок Authorization.
+// Запросы без заголовка проходят анонимно, с невалидным токеном - отклоняются.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := a.Verify(bearerToken(header))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// WebsocketInitFunc проверяет токен из payload сообщения connection_init,
+// т.к. браузеры не умеют передавать заголовки при открытии websocket.
+func (a *Authenticator) WebsocketInitFunc(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+	header := payload.Authorization()
+	if header == "" {
+		return ctx, &payload, nil
+	}
+
+	user, err := a.Verify(bearerToken(header))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return WithUser(ctx, user), &payload, nil
+}
+
+func bearerToken(header string) string {
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return strings.TrimSpace(header)
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StorageModePostgres = "postgres"
+	StorageModeMemory   = "memory"
+)
+
+const (
+	DefaultConfigFile = "configs/config.yaml"
+	DefaultEnvFile    = ".env"
+	// EnvPrefix - префикс переменных окружения: db.host переопределяется OZON_DB_HOST
+	EnvPrefix = "OZON"
+)
+
+// Config - настройки сервиса. Значения берутся по возрастанию приоритета: значения по умолчанию,
+// YAML-файл, переменные окружения (в том числе из .env), флаги командной строки.
+type Config struct {
+	HTTP          HTTPConfig          `mapstructure:"http"`
+	Storage       StorageConfig       `mapstructure:"storage"`
+	DB            DBConfig            `mapstructure:"db"`
+	Memory        MemoryConfig        `mapstructure:"memory"`
+	GraphQL       GraphQLConfig       `mapstructure:"graphql"`
+	Validation    ValidationConfig    `mapstructure:"validation"`
+	Auth          AuthConfig          `mapstructure:"auth"`
+	Comments      CommentsConfig      `mapstructure:"comments"`
+	Subscriptions SubscriptionsConfig `mapstructure:"subscriptions"`
+}
+
+type HTTPConfig struct {
+	Port string `mapstructure:"port"`
+	// ShutdownTimeout - сколько ждать завершения запросов при остановке
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// DrainDelay - сколько /readyz отвечает 503 перед остановкой сервера, чтобы балансировщик убрал экземпляр
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+}
+
+type StorageConfig struct {
+	// Mode - postgres или memory
+	Mode string `mapstructure:"mode"`
+}
+
+type DBConfig struct {
+	Host        string `mapstructure:"host"`
+	Port        string `mapstructure:"port"`
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	DBName      string `mapstructure:"dbname"`
+	SSLMode     string `mapstructure:"sslmode"`
+	AutoMigrate bool   `mapstructure:"auto_migrate"`
+	// Пул соединений, 0 - значение database/sql по умолчанию
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+}
+
+type MemoryConfig struct {
+	SnapshotFile        string        `mapstructure:"snapshot_file"`
+	SnapshotKeep        int           `mapstructure:"snapshot_keep"`
+	SnapshotInterval    time.Duration `mapstructure:"snapshot_interval"`
+	JournalFile         string        `mapstructure:"journal_file"`
+	JournalSyncInterval time.Duration `mapstructure:"journal_sync_interval"`
+}
+
+type GraphQLConfig struct {
+	MaxDepth      int `mapstructure:"max_depth"`
+	MaxComplexity int `mapstructure:"max_complexity"`
+}
+
+type ValidationConfig struct {
+	MaxTitleLength    int `mapstructure:"max_title_length"`
+	MaxPostLength     int `mapstructure:"max_post_length"`
+	MaxCommentLength  int `mapstructure:"max_comment_length"`
+	MaxUsernameLength int `mapstructure:"max_username_length"`
+}
+
+type AuthConfig struct {
+	HS256Secret        string `mapstructure:"hs256_secret"`
+	RS256PublicKeyFile string `mapstructure:"rs256_public_key_file"`
+}
+
+type CommentsConfig struct {
+	CloseAfter time.Duration `mapstructure:"close_after"`
+}
+
+type SubscriptionsConfig struct {
+	// KeepAliveInterval - период ping в websocket-подписках
+	KeepAliveInterval time.Duration `mapstructure:"keep_alive_interval"`
+}
+
+var defaults = map[string]any{
+	"http.port":                         "8080",
+	"http.shutdown_timeout":             "10s",
+	"http.drain_delay":                  "5s",
+	"storage.mode":                      StorageModePostgres,
+	"db.host":                           "localhost",
+	"db.port":                           "5432",
+	"db.username":                       "postgres",
+	"db.password":                       "",
+	"db.dbname":                         "ozonDb",
+	"db.sslmode":                        "disable",
+	"db.auto_migrate":                   true,
+	"db.max_open_conns":                 0,
+	"db.max_idle_conns":                 0,
+	"db.conn_max_lifetime":              "0s",
+	"memory.snapshot_file":              "storage.json",
+	"memory.snapshot_keep":              3,
+	"memory.snapshot_interval":          "5m",
+	"memory.journal_file":               "storage.journal",
+	"memory.journal_sync_interval":      "0s",
+	"graphql.max_depth":                 15,
+	"graphql.max_complexity":            10000,
+	"validation.max_title_length":       255,
+	"validation.max_post_length":        10000,
+	"validation.max_comment_length":     2000,
+	"validation.max_username_length":    255,
+	"auth.hs256_secret":                 "",
+	"auth.rs256_public_key_file":        "",
+	"comments.close_after":              "0s",
+	"subscriptions.keep_alive_interval": "10s",
+}
+
+// legacyEnv - переменные окружения без префикса, которые читались до появления конфигурации.
+// Переменная с префиксом важнее.
+var legacyEnv = map[string]string{
+	"db.password":       "DB_PASSWORD",
+	"auth.hs256_secret": "AUTH_HS256_SECRET",
+}
+
+// Load разбирает флаги из args, загружает .env и YAML-файл и возвращает проверенную конфигурацию
+// вместе с оставшимися аргументами (например, migrate up). Отсутствие .env - не ошибка,
+// отсутствие YAML-файла - ошибка, только если путь задан явно.
+func Load(args []string) (*Config, []string, error) {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := flags.String("config", DefaultConfigFile, "path to YAML config")
+	envFile := flags.String("env-file", "", "path to .env file (default $OZON_ENV_FILE or .env)")
+	useMemory := flags.Bool("m", false, "use in-memory storage, same as -storage memory")
+	mode := flags.String("storage", "", "storage mode: postgres or memory")
+	port := flags.String("port", "", "HTTP port")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if err := loadEnvFile(*envFile); err != nil {
+		return nil, nil, err
+	}
+
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for key, legacy := range legacyEnv {
+		if err := v.BindEnv(key, EnvPrefix+"_"+strings.ToUpper(strings.ReplaceAll(key, ".", "_")), legacy); err != nil {
+			return nil, nil, fmt.Errorf("config: %w", err)
+		}
+	}
+
+	v.SetConfigFile(*configFile)
+	if err := v.ReadInConfig(); err != nil {
+		if !errors.Is(err, os.ErrNotExist) || explicit["config"] {
+			return nil, nil, fmt.Errorf("config: read %s: %w", *configFile, err)
+		}
+	}
+
+	if *useMemory {
+		v.Set("storage.mode", StorageModeMemory)
+	}
+	if explicit["storage"] {
+		v.Set("storage.mode", *mode)
+	}
+	if explicit["port"] {
+		v.Set("http.port", *port)
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, flags.Args(), nil
+}
+
+// loadEnvFile подгружает переменные из .env, не перетирая уже заданные в окружении.
+func loadEnvFile(path string) error {
+	if path == "" {
+		path = os.Getenv(EnvPrefix + "_ENV_FILE")
+	}
+	if path == "" {
+		path = DefaultEnvFile
+	}
+
+	err := godotenv.Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config: load %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate проверяет конфигурацию целиком и перечисляет все ошибки, а не только первую.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.HTTP.Port)
+	check(err == nil && port > 0 && port <= 65535, "http.port", "must be a number from 1 to 65535, got %q", c.HTTP.Port)
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout", "must be positive, got %s", c.HTTP.ShutdownTimeout)
+	check(c.HTTP.DrainDelay >= 0, "http.drain_delay", "must not be negative")
+
+	switch c.Storage.Mode {
+	case StorageModePostgres:
+		check(c.DB.Host != "", "db.host", "is required for postgres storage")
+		check(c.DB.Port != "", "db.port", "is required for postgres storage")
+		check(c.DB.Username != "", "db.username", "is required for postgres storage")
+		check(c.DB.DBName != "", "db.dbname", "is required for postgres storage")
+		check(c.DB.MaxOpenConns >= 0, "db.max_open_conns", "must not be negative")
+		check(c.DB.MaxIdleConns >= 0, "db.max_idle_conns", "must not be negative")
+		check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime", "must not be negative")
+	case StorageModeMemory:
+		check(c.Memory.SnapshotFile != "", "memory.snapshot_file", "is required for memory storage")
+		check(c.Memory.JournalFile != "", "memory.journal_file", "is required for memory storage")
+		check(c.Memory.SnapshotFile != c.Memory.JournalFile, "memory.journal_file", "must differ from memory.snapshot_file")
+		check(c.Memory.SnapshotKeep >= 0, "memory.snapshot_keep", "must not be negative")
+		check(c.Memory.SnapshotInterval >= 0, "memory.snapshot_interval", "must not be negative")
+		check(c.Memory.JournalSyncInterval >= 0, "memory.journal_sync_interval", "must not be negative")
+	default:
+		check(false, "storage.mode", "must be %q or %q, got %q", StorageModePostgres, StorageModeMemory, c.Storage.Mode)
+	}
+
+	check(c.GraphQL.MaxDepth >= 0, "graphql.max_depth", "must not be negative")
+	check(c.GraphQL.MaxComplexity >= 0, "graphql.max_complexity", "must not be negative")
+
+	//Заголовок и имя пользователя хранятся в VARCHAR(255)
+	check(c.Validation.MaxTitleLength >= 0 && c.Validation.MaxTitleLength <= 255, "validation.max_title_length", "must be from 0 to 255")
+	check(c.Validation.MaxUsernameLength >= 0 && c.Validation.MaxUsernameLength <= 255, "validation.max_username_length", "must be from 0 to 255")
+	check(c.Validation.MaxPostLength >= 0, "validation.max_post_length", "must not be negative")
+	check(c.Validation.MaxCommentLength >= 0, "validation.max_comment_length", "must not be negative")
+
+	check(c.Comments.CloseAfter >= 0, "comments.close_after", "must not be negative")
+	check(c.Subscriptions.KeepAliveInterval > 0, "subscriptions.keep_alive_interval", "must be positive, got %s", c.Subscriptions.KeepAliveInterval)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
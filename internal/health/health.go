@@ -0,0 +1,189 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"log"
+	"net/http"
+	"ozon-graphql-api/pkg/memory"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+)
+
+// DefaultTimeout - сколько ждать одну проверку, чтобы зависшая зависимость не задерживала ответ пробе.
+const DefaultTimeout = 2 * time.Second
+
+// Check проверяет зависимость, nil - зависимость доступна.
+type Check func(ctx context.Context) error
+
+// Result - состояние одной зависимости в ответе.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report - тело ответа /healthz и /readyz.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker отвечает пробам оркестратора. Liveness говорит, что процесс жив и перезапуск не нужен,
+// readiness - что зависимости доступны и на экземпляр можно направлять запросы.
+type Checker struct {
+	timeout   time.Duration
+	liveness  []namedCheck
+	readiness []namedCheck
+	draining  atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// AddLiveness добавляет проверку в /healthz. Сюда попадают только поломки, которые лечит перезапуск:
+// недоступная база перезапуском не чинится и должна снимать экземпляр с балансировки через /readyz.
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.liveness = append(c.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadiness добавляет проверку в /readyz.
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.readiness = append(c.readiness, namedCheck{name: name, check: check})
+}
+
+// Drain переводит readiness в состояние shutting_down: балансировщик перестает слать новые запросы,
+// пока сервер дорабатывает текущие. Liveness при этом не меняется, иначе экземпляр убьют раньше времени.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Shutdown останавливает сервер: сначала /readyz начинает отвечать 503, и только через delay сервер
+// перестает принимать соединения, так что балансировщик успевает снять экземпляр. Текущие запросы
+// дорабатывают не дольше timeout.
+func (c *Checker) Shutdown(server *http.Server, delay, timeout time.Duration) error {
+	c.Drain()
+	if delay > 0 {
+		log.Printf("draining for %s", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return server.Shutdown(ctx)
+}
+
+// Liveness возвращает обработчик /healthz.
+func (c *Checker) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.run(r.Context(), c.liveness)
+		writeReport(w, report)
+	})
+}
+
+// Readiness возвращает обработчик /readyz. Во время остановки проверки выполняются, но ответ - 503.
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.run(r.Context(), c.readiness)
+		if c.Draining() {
+			report.Status = StatusShuttingDown
+		}
+		writeReport(w, report)
+	})
+}
+
+// run выполняет проверки параллельно, каждую со своим таймаутом.
+func (c *Checker) run(ctx context.Context, checks []namedCheck) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := nc.check(checkCtx)
+			result := Result{Status: StatusOK, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[nc.name] = result
+			if err != nil {
+				report.Status = StatusFail
+			}
+		}(nc)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("error writing health report: %v", err)
+	}
+}
+
+// Postgres проверяет соединение с базой запросом ping.
+func Postgres(db *sqlx.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// MemoryStorage проверяет, что хранилище загружено из снимка и журнала и журнал принимает записи.
+func MemoryStorage(storage *memory.Storage) Check {
+	return func(ctx context.Context) error {
+		if storage == nil {
+			return errors.New("storage is not loaded")
+		}
+		return MemoryJournal(storage)(ctx)
+	}
+}
+
+// MemoryJournal проверяет только журнал: после ошибки записи он отклоняет все мутации до перезапуска.
+func MemoryJournal(storage *memory.Storage) Check {
+	return func(ctx context.Context) error {
+		if storage == nil || storage.Journal == nil {
+			return nil
+		}
+		return storage.Journal.Err()
+	}
+}
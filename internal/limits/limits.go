@@ -0,0 +1,229 @@
+package limits
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	CodeTooDeep    = "QUERY_TOO_DEEP"
+	CodeTooComplex = "QUERY_TOO_COMPLEX"
+)
+
+// pageArgument - аргумент, задающий размер страницы: стоимость вложенных полей умножается на него.
+const pageArgument = "first"
+
+// costCeiling - стоимость, выше которой подсчет не растет. Без насыщения вложенные страницы с огромным
+// first переполняли бы int, и отрицательная стоимость проходила бы проверку бюджета.
+const costCeiling = math.MaxInt32
+
+type Config struct {
+	// MaxDepth - максимальная вложенность полей, 0 - без ограничения
+	MaxDepth int
+	// MaxComplexity - бюджет сложности операции, 0 - без ограничения
+	MaxComplexity int
+}
+
+// Limits отклоняет слишком глубокие и слишком дорогие операции до их выполнения.
+// Стоимость поля - 1 плюс стоимость вложенных полей, умноженная на first для страниц.
+// Служебные поля интроспекции (__schema, __type) не учитываются.
+type Limits struct {
+	cfg Config
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = &Limits{}
+
+func New(cfg Config) *Limits {
+	return &Limits{cfg: cfg}
+}
+
+func (l *Limits) ExtensionName() string {
+	return "QueryLimits"
+}
+
+func (l *Limits) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (l *Limits) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	if rc.Operation == nil {
+		return nil
+	}
+
+	root := measure(nil, rc.Operation.SelectionSet, rc.Variables)
+
+	if l.cfg.MaxDepth > 0 {
+		if deepest := root.deepest(); deepest.depth > l.cfg.MaxDepth {
+			return &gqlerror.Error{
+				Message:   fmt.Sprintf("operation is nested %d levels deep at %s, which exceeds the limit of %d", deepest.depth, deepest.path, l.cfg.MaxDepth),
+				Path:      deepest.path,
+				Locations: deepest.locations(),
+				Extensions: map[string]interface{}{
+					"code":     CodeTooDeep,
+					"depth":    deepest.depth,
+					"maxDepth": l.cfg.MaxDepth,
+				},
+			}
+		}
+	}
+
+	if l.cfg.MaxComplexity > 0 && root.cost > l.cfg.MaxComplexity {
+		offender := root.offender(l.cfg.MaxComplexity)
+		return &gqlerror.Error{
+			Message: fmt.Sprintf("operation has complexity %d, which exceeds the limit of %d; most expensive field is %s with complexity %d",
+				root.cost, l.cfg.MaxComplexity, offender.path, offender.cost),
+			Path:      offender.path,
+			Locations: offender.locations(),
+			Extensions: map[string]interface{}{
+				"code":          CodeTooComplex,
+				"complexity":    root.cost,
+				"maxComplexity": l.cfg.MaxComplexity,
+				"fieldCost":     offender.cost,
+			},
+		}
+	}
+
+	return nil
+}
+
+// node - поле операции с его путем в ответе, глубиной и стоимостью вместе с вложенными полями.
+type node struct {
+	field    *ast.Field
+	path     ast.Path
+	depth    int
+	cost     int
+	children []*node
+}
+
+func (n *node) locations() []gqlerror.Location {
+	if n.field == nil || n.field.Position == nil {
+		return nil
+	}
+	return []gqlerror.Location{{Line: n.field.Position.Line, Column: n.field.Position.Column}}
+}
+
+// measure строит дерево полей. Поля из фрагментов считаются полями родителя:
+// для union это завышает оценку, зато ее нельзя обойти, спрятав поля во фрагмент.
+func measure(parent *node, set ast.SelectionSet, vars map[string]interface{}) *node {
+	if parent == nil {
+		parent = &node{}
+	}
+
+	for _, field := range collectFields(set) {
+		if strings.HasPrefix(field.Name, "__") {
+			continue
+		}
+
+		path := make(ast.Path, len(parent.path), len(parent.path)+1)
+		copy(path, parent.path)
+
+		child := &node{
+			field: field,
+			path:  append(path, ast.PathName(field.Alias)),
+			depth: parent.depth + 1,
+		}
+		measure(child, field.SelectionSet, vars)
+
+		childCost := 0
+		for _, grandchild := range child.children {
+			childCost = saturatingAdd(childCost, grandchild.cost)
+		}
+		child.cost = saturatingAdd(1, saturatingMul(childCost, pageSize(field, vars)))
+
+		parent.children = append(parent.children, child)
+	}
+
+	if parent.field == nil {
+		for _, child := range parent.children {
+			parent.cost = saturatingAdd(parent.cost, child.cost)
+		}
+	}
+
+	return parent
+}
+
+func collectFields(set ast.SelectionSet) []*ast.Field {
+	var fields []*ast.Field
+	for _, selection := range set {
+		switch s := selection.(type) {
+		case *ast.Field:
+			fields = append(fields, s)
+		case *ast.InlineFragment:
+			fields = append(fields, collectFields(s.SelectionSet)...)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				fields = append(fields, collectFields(s.Definition.SelectionSet)...)
+			}
+		}
+	}
+	return fields
+}
+
+// pageSize возвращает значение first с учетом значения по умолчанию из схемы, для остальных полей - 1.
+func pageSize(field *ast.Field, vars map[string]interface{}) int {
+	if field.Definition == nil || field.Definition.Arguments.ForName(pageArgument) == nil {
+		return 1
+	}
+
+	switch size := field.ArgumentMap(vars)[pageArgument].(type) {
+	case int:
+		return int(min(max(int64(size), 1), costCeiling))
+	case int64:
+		return int(min(max(size, 1), costCeiling))
+	}
+	return 1
+}
+
+// saturatingAdd и saturatingMul складывают и умножают неотрицательные стоимости, не выходя за costCeiling.
+func saturatingAdd(a, b int) int {
+	if a > costCeiling-b {
+		return costCeiling
+	}
+	return a + b
+}
+
+func saturatingMul(a, b int) int {
+	if b != 0 && a > costCeiling/b {
+		return costCeiling
+	}
+	return a * b
+}
+
+func (n *node) deepest() *node {
+	result := n
+	for _, child := range n.children {
+		if d := child.deepest(); d.depth > result.depth {
+			result = d
+		}
+	}
+	return result
+}
+
+// offender спускается по самым дорогим полям, пока поле само по себе превышает бюджет,
+// и возвращает самое глубокое такое поле - его и нужно урезать клиенту.
+func (n *node) offender(limit int) *node {
+	var expensive *node
+	for _, child := range n.children {
+		if expensive == nil || child.cost > expensive.cost {
+			expensive = child
+		}
+	}
+
+	if expensive == nil {
+		return n
+	}
+	if expensive.cost <= limit && n.field != nil {
+		return n
+	}
+
+	return expensive.offender(limit)
+}
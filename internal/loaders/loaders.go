@@ -0,0 +1,109 @@
+package loaders
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/dataloader"
+	"strings"
+	"sync"
+)
+
+type contextKey struct{}
+
+// Loaders собирает обращения резолверов за пользователями и комментариями в пакетные запросы
+// и кэширует ответы в пределах одного запроса.
+type Loaders struct {
+	repos *repository.Repository
+
+	users    *dataloader.Loader[string, *model.User]
+	comments *dataloader.Loader[string, *model.Comment]
+
+	//Страницы комментариев зависят от аргументов поля, поэтому загрузчик свой для каждого набора аргументов
+	mu               sync.Mutex
+	commentsByPost   map[string]*dataloader.Loader[string, *model.CommentConnection]
+	repliesByComment map[string]*dataloader.Loader[string, *model.CommentConnection]
+}
+
+func New(repos *repository.Repository) *Loaders {
+	return &Loaders{
+		repos:            repos,
+		users:            dataloader.New(repos.UsersByIDs, 0, 0),
+		comments:         dataloader.New(repos.CommentsByIDs, 0, 0),
+		commentsByPost:   make(map[string]*dataloader.Loader[string, *model.CommentConnection]),
+		repliesByComment: make(map[string]*dataloader.Loader[string, *model.CommentConnection]),
+	}
+}
+
+// Middleware создает загрузчики на каждый HTTP-запрос. Websocket-подписки живут дольше запроса,
+// кэш на все соединение отдавал бы устаревшие данные, поэтому для них загрузчики не создаются.
+func Middleware(repos *repository.Repository, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKey{}, New(repos))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// For возвращает загрузчики запроса или nil, если Middleware их не создал.
+func For(ctx context.Context) *Loaders {
+	loaders, _ := ctx.Value(contextKey{}).(*Loaders)
+	return loaders
+}
+
+// User возвращает nil, если пользователя не существует.
+func (l *Loaders) User(ctx context.Context, id string) (*model.User, error) {
+	return l.users.Load(ctx, id)
+}
+
+// Comment возвращает nil, если комментария не существует.
+func (l *Loaders) Comment(ctx context.Context, id string) (*model.Comment, error) {
+	return l.comments.Load(ctx, id)
+}
+
+func (l *Loaders) CommentsByPost(ctx context.Context, postID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	loader := l.pageLoader(l.commentsByPost, sort, first, after, l.repos.CommentsByPosts)
+	return loader.Load(ctx, postID)
+}
+
+func (l *Loaders) RepliesByComment(ctx context.Context, commentID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	loader := l.pageLoader(l.repliesByComment, sort, first, after, l.repos.RepliesByComments)
+	return loader.Load(ctx, commentID)
+}
+
+type pagesFunc func(ctx context.Context, parentIDs []string, sort model.CommentSort, first *int, after *string) (map[string]*model.CommentConnection, error)
+
+func (l *Loaders) pageLoader(loaders map[string]*dataloader.Loader[string, *model.CommentConnection], sort model.CommentSort, first *int, after *string, pages pagesFunc) *dataloader.Loader[string, *model.CommentConnection] {
+	key := pageKey(sort, first, after)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	loader, ok := loaders[key]
+	if !ok {
+		loader = dataloader.New(func(ctx context.Context, parentIDs []string) (map[string]*model.CommentConnection, error) {
+			return pages(ctx, parentIDs, sort, first, after)
+		}, 0, 0)
+		loaders[key] = loader
+	}
+
+	return loader
+}
+
+func pageKey(sort model.CommentSort, first *int, after *string) string {
+	size := "-"
+	if first != nil {
+		size = fmt.Sprint(*first)
+	}
+	cursor := ""
+	if after != nil {
+		cursor = *after
+	}
+	return fmt.Sprintf("%s|%s|%s", sort, size, cursor)
+}
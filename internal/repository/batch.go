@@ -0,0 +1,14 @@
+package repository
+
+import "strconv"
+
+// batchIDs переводит id в числа для WHERE id = ANY($1). Нечисловых id в базе нет, поэтому они пропускаются.
+func batchIDs(ids []string) []int64 {
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			result = append(result, n)
+		}
+	}
+	return result
+}
@@ -2,101 +2,239 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"ozon-graphql-api/graph/model"
 	"ozon-graphql-api/pkg/memory"
-	"sort"
 	"strconv"
 	"time"
 )
 
 type MemoryCommentRepository struct {
 	Storage *memory.Storage
+	Events  *MemoryCommentEvents
 }
 
-func NewMemoryCommentRepo(storage *memory.Storage) *MemoryCommentRepository {
+func NewMemoryCommentRepo(storage *memory.Storage, events *MemoryCommentEvents) *MemoryCommentRepository {
 	return &MemoryCommentRepository{
 		Storage: storage,
+		Events:  events,
 	}
 }
 
-func (r *MemoryCommentRepository) Comments(ctx context.Context, limit, offset *int) ([]*model.Comment, error) {
-	r.Storage.Mu.RLock()
-	defer r.Storage.Mu.RUnlock()
+func (r *MemoryCommentRepository) Comments(ctx context.Context, sort model.CommentSort, createdAt *model.DateRange, first *int, after *string) (*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortNew)
+	if err != nil {
+		return nil, err
+	}
+	return r.commentsPage(commentsByTime, nil, createdAt, mode, first, after)
+}
+
+func (r *MemoryCommentRepository) CommentsByUser(ctx context.Context, userID string, first *int, after *string) (*model.CommentConnection, error) {
+	return r.commentsPage(commentsByTime, func(comment *model.Comment) bool {
+		return comment.Sender != nil && comment.Sender.ID == userID
+	}, nil, sortNew, first, after)
+}
 
-	var comments []*model.Comment
-	for _, comment := range r.Storage.Comments {
-		comments = append(comments, comment)
+func (r *MemoryCommentRepository) CommentsByPost(ctx context.Context, postID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortOld)
+	if err != nil {
+		return nil, err
 	}
+	return r.commentsPage(func(tx *memory.Tx) *memory.TimeOrder {
+		return tx.RootComments(postID)
+	}, nil, nil, mode, first, after)
+}
 
-	//Т.к. обход мап в гошке случайный, отсортируем нашу мапу по дате добавления для красивого вывода
-	sort.Slice(comments, func(i, j int) bool {
-		return comments[i].CreatedAt > comments[j].CreatedAt
+func (r *MemoryCommentRepository) RepliesByComment(ctx context.Context, commentID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortOld)
+	if err != nil {
+		return nil, err
+	}
+	return r.commentsPage(func(tx *memory.Tx) *memory.TimeOrder {
+		return tx.RepliesTo(commentID)
+	}, nil, nil, mode, first, after)
+}
+
+func (r *MemoryCommentRepository) CommentsByIDs(ctx context.Context, ids []string) (map[string]*model.Comment, error) {
+	comments := make(map[string]*model.Comment, len(ids))
+	err := r.Storage.View(func(tx *memory.Tx) error {
+		for _, id := range ids {
+			if comment, ok := tx.Comments[id]; ok {
+				comments[id] = memory.CopyComment(comment)
+			}
+		}
+		return nil
 	})
 
-	start := *offset
-	end := start + *limit
+	return comments, err
+}
 
-	if end > len(comments) {
-		end = len(comments)
+// CommentsByPosts в памяти нет сетевых запросов, поэтому пакетный вариант просто обходит родителей.
+func (r *MemoryCommentRepository) CommentsByPosts(ctx context.Context, postIDs []string, sort model.CommentSort, first *int, after *string) (map[string]*model.CommentConnection, error) {
+	connections := make(map[string]*model.CommentConnection, len(postIDs))
+	for _, id := range postIDs {
+		connection, err := r.CommentsByPost(ctx, id, sort, first, after)
+		if err != nil {
+			return nil, err
+		}
+		connections[id] = connection
 	}
+	return connections, nil
+}
 
-	if start > len(comments) {
-		return []*model.Comment{}, nil
+func (r *MemoryCommentRepository) RepliesByComments(ctx context.Context, commentIDs []string, sort model.CommentSort, first *int, after *string) (map[string]*model.CommentConnection, error) {
+	connections := make(map[string]*model.CommentConnection, len(commentIDs))
+	for _, id := range commentIDs {
+		connection, err := r.RepliesByComment(ctx, id, sort, first, after)
+		if err != nil {
+			return nil, err
+		}
+		connections[id] = connection
 	}
-
-	return comments[start:end], nil
+	return connections, nil
 }
 
-func (r *MemoryCommentRepository) CreateComment(ctx context.Context, input model.NewComment) (*model.Comment, error) {
-	r.Storage.Mu.RLock()
-	post, ok := r.Storage.Posts[input.PostID]
-	r.Storage.Mu.RUnlock()
-	if !ok {
-		return nil, errors.New("post not found")
+// commentsPage обходит индекс ленты, который order берет из хранилища внутри транзакции.
+func (r *MemoryCommentRepository) commentsPage(order func(tx *memory.Tx) *memory.TimeOrder, match func(comment *model.Comment) bool, createdAt *model.DateRange, mode sortMode, first *int, after *string) (*model.CommentConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
 	}
 
-	if !post.IsCommentingAvailable {
-		return nil, errors.New("commenting is not allowed on this post")
+	var connection *model.CommentConnection
+	err = r.Storage.View(func(tx *memory.Tx) error {
+		page, ranks, err := orderedPage(order(tx), tx.Comments, match, createdAt, commentSortKey(mode), mode, c, size)
+		if err != nil {
+			return err
+		}
+
+		for i, comment := range page {
+			page[i] = memory.CopyComment(comment)
+		}
+		connection = newCommentConnection(page, ranks, size, mode)
+		return nil
+	})
+
+	return connection, err
+}
+
+func commentsByTime(tx *memory.Tx) *memory.TimeOrder {
+	return tx.CommentsByTime()
+}
+
+// CreateComment вызывает check в одной критической секции со вставкой, как репозиторий базы
+// в транзакции: пост или родитель не пропадут и комментарии не закроются между проверкой и записью.
+func (r *MemoryCommentRepository) CreateComment(ctx context.Context, input model.NewComment, check CommentCheck) (*model.Comment, error) {
+	var comment *model.Comment
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		var target CommentTarget
+		if post, ok := tx.Posts[input.PostID]; ok {
+			target.Post = memory.CopyPost(post)
+		}
+		sender, ok := tx.Users[input.SenderID]
+		if ok {
+			target.Sender = sender
+		} else {
+			sender = &model.User{ID: input.SenderID}
+		}
+		if input.ReplyTo != nil {
+			if parent, ok := tx.Comments[*input.ReplyTo]; ok {
+				target.Parent = memory.CopyComment(parent)
+			}
+		}
+
+		if err := check(target); err != nil {
+			return err
+		}
+
+		tx.CommentIdCounter++
+		commentId := strconv.Itoa(tx.CommentIdCounter)
+
+		newComment := &model.Comment{
+			ID:        commentId,
+			PostID:    input.PostID,
+			Sender:    sender,
+			Text:      input.Text,
+			CreatedAt: time.Now().UTC(),
+		}
+		tx.AttachComment(newComment, input.ReplyTo)
+		tx.PutComment(newComment)
+		tx.Record(memory.CommentSaved(newComment))
+
+		comment = memory.CopyComment(newComment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	r.Storage.Mu.RLock()
-	sender, ok := r.Storage.Users[input.SenderID]
-	r.Storage.Mu.RUnlock()
-	if !ok {
-		return nil, errors.New("sender not found")
+	if r.Events != nil {
+		r.Events.publish(comment.PostID, comment)
 	}
 
-	r.Storage.Mu.Lock()
-	r.Storage.CommentIdCounter++
-	commentId := strconv.Itoa(r.Storage.CommentIdCounter)
-	r.Storage.Mu.Unlock()
-
-	newComment := &model.Comment{
-		ID:        commentId,
-		PostID:    input.PostID,
-		Sender:    sender,
-		ReplyTo:   nil,
-		Text:      input.Text,
-		CreatedAt: time.Now().Format(time.RFC3339),
+	return comment, nil
+}
+
+func (r *MemoryCommentRepository) UpdateComment(ctx context.Context, id, userID, text string) (*model.Comment, error) {
+	var updated *model.Comment
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		comment, err := r.checkAuthor(tx, id, userID)
+		if err != nil {
+			return err
+		}
+
+		editedAt := time.Now().UTC()
+		comment.Text = text
+		comment.EditedAt = &editedAt
+		tx.IndexComment(comment)
+		tx.Record(memory.CommentSaved(comment))
+
+		updated = memory.CopyComment(comment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if input.ReplyTo != nil {
-		comment, ok := r.Storage.Comments[*input.ReplyTo]
-		if !ok {
-			return nil, errors.New("comment you want to reply to doesn't exist")
+	return updated, nil
+}
+
+func (r *MemoryCommentRepository) DeleteComment(ctx context.Context, id, userID string) error {
+	return r.Storage.Update(func(tx *memory.Tx) error {
+		comment, err := r.checkAuthor(tx, id, userID)
+		if err != nil {
+			return err
 		}
 
-		newComment.ReplyTo = &model.Comment{
-			ID: *input.ReplyTo,
+		//Комментарий без ответов удаляем целиком, иначе оставляем надгробие, чтобы не рвать дерево
+		if tx.RepliesTo(id).Len() > 0 {
+			deletedAt := time.Now().UTC()
+			comment.Text = model.DeletedText
+			comment.DeletedAt = &deletedAt
+			tx.IndexComment(comment)
+			tx.Record(memory.CommentSaved(comment))
+			return nil
 		}
 
-		comment.Replies = append(comment.Replies, newComment)
+		tx.DeleteComment(id)
+		tx.Record(memory.CommentDeleted(id))
+		return nil
+	})
+}
+
+// checkAuthor вызывается внутри транзакции хранилища.
+func (r *MemoryCommentRepository) checkAuthor(tx *memory.Tx, id, userID string) (*model.Comment, error) {
+	comment, ok := tx.Comments[id]
+	if !ok {
+		return nil, ErrCommentNotFound
+	}
+
+	if comment.Sender == nil || comment.Sender.ID != userID {
+		return nil, ErrNotCommentAuthor
 	}
 
-	r.Storage.Mu.Lock()
-	r.Storage.Comments[commentId] = newComment
-	r.Storage.Mu.Unlock()
+	if comment.DeletedAt != nil {
+		return nil, ErrCommentDeleted
+	}
 
-	return newComment, nil
+	return comment, nil
 }
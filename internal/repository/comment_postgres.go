@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"ozon-graphql-api/graph/model"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type PostgresCommentRepository struct {
@@ -20,100 +23,251 @@ func NewPostgresCommentRepo(db *sqlx.DB) *PostgresCommentRepository {
 	}
 }
 
-func (r *PostgresCommentRepository) Comments(ctx context.Context, limit, offset *int) ([]*model.Comment, error) {
-	queryLimit := *limit
-	queryOffset := *offset
+func (r *PostgresCommentRepository) Comments(ctx context.Context, sort model.CommentSort, createdAt *model.DateRange, first *int, after *string) (*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortNew)
+	if err != nil {
+		return nil, err
+	}
+	conditions, args := dateRangeSQL("c.createdAt", 1, createdAt)
+	return r.commentsPage(ctx, strings.Join(conditions, " AND "), args, mode, first, after)
+}
 
-	commentFields := `c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.id, u.username`
+func (r *PostgresCommentRepository) CommentsByUser(ctx context.Context, userID string, first *int, after *string) (*model.CommentConnection, error) {
+	return r.commentsPage(ctx, `c.sender = $1`, []interface{}{userID}, sortNew, first, after)
+}
 
-	query := fmt.Sprintf(`SELECT %s FROM %s c JOIN %s u on c.sender = u.id 
-                              ORDER BY createdat DESC LIMIT $1 OFFSET $2`,
-		commentFields, commentsTable, usersTable)
+func (r *PostgresCommentRepository) CommentsByPost(ctx context.Context, postID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortOld)
+	if err != nil {
+		return nil, err
+	}
+	postId, err := strconv.Atoi(postID)
+	if err != nil {
+		return emptyCommentPage(mode, first, after)
+	}
+	return r.commentsPage(ctx, `c.postid = $1 AND c.replyto IS NULL`, []interface{}{postId}, mode, first, after)
+}
+
+func (r *PostgresCommentRepository) RepliesByComment(ctx context.Context, commentID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortOld)
+	if err != nil {
+		return nil, err
+	}
+	commentId, err := strconv.Atoi(commentID)
+	if err != nil {
+		return emptyCommentPage(mode, first, after)
+	}
+	return r.commentsPage(ctx, `c.replyto = $1`, []interface{}{commentId}, mode, first, after)
+}
+
+// emptyCommentPage - лента записи с нечисловым id: такой записи в базе нет, и лента пуста, как в памяти.
+// Аргументы страницы проверяются так же, как для существующей записи.
+func emptyCommentPage(mode sortMode, first *int, after *string) (*model.CommentConnection, error) {
+	size, _, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	return newCommentConnection(nil, nil, size, mode), nil
+}
+
+// commentsPage отдает комментарии в порядке mode. Параметры filter нумеруются с $1 и передаются в args.
+func (r *PostgresCommentRepository) commentsPage(ctx context.Context, filter string, args []interface{}, mode sortMode, first *int, after *string) (*model.CommentConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	rank, _ := mode.rankSQL("c")
+	commentFields := `c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.username, c.editedat, c.deletedat, c.upvotes, c.downvotes, ` + rank + ` AS rank`
+
+	var conditions []string
+	if filter != "" {
+		conditions = append(conditions, filter)
+	}
+	if c != nil {
+		condition, cursorArgs, err := mode.afterSQL("c", len(args)+1, c)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	args = append(args, size+1)
+
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s c JOIN %s u on c.sender = u.id %s
+                              ORDER BY %s LIMIT $%d`,
+		commentFields, commentsTable, usersTable, where, mode.orderSQL("c"), len(args))
 
 	// Промежуточная структура для маппинга
 	var dbComments []dbCommentStruct
-	err := r.Db.SelectContext(ctx, &dbComments, query, queryLimit, queryOffset)
-	if err != nil {
+	if err := r.Db.SelectContext(ctx, &dbComments, query, args...); err != nil {
 		return nil, err
 	}
 
 	var comments []*model.Comment
+	var ranks []float64
 	for _, c := range dbComments {
-		comment := &model.Comment{
-			ID:     strconv.Itoa(c.ID),
-			PostID: strconv.Itoa(c.PostID),
-			Sender: &model.User{
-				ID:       strconv.Itoa(c.SenderID),
-				Username: *c.Username,
-			},
-			ReplyTo:   nil,
-			Text:      c.Text,
-			CreatedAt: c.CreatedAt,
-		}
+		comments = append(comments, toModelComment(c))
+		ranks = append(ranks, c.Rank)
+	}
 
-		if c.ReplyTo != nil {
-			comment.ReplyTo = &model.Comment{
-				ID: strconv.Itoa(*c.ReplyTo),
-			}
-		}
+	return newCommentConnection(comments, ranks, size, mode), nil
+}
+
+func (r *PostgresCommentRepository) CommentsByIDs(ctx context.Context, ids []string) (map[string]*model.Comment, error) {
+	commentFields := `c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.username, c.editedat, c.deletedat, c.upvotes, c.downvotes`
+	query := fmt.Sprintf(`SELECT %s FROM %s c JOIN %s u on c.sender = u.id WHERE c.id = ANY($1)`,
+		commentFields, commentsTable, usersTable)
 
-		comments = append(comments, comment)
+	var dbComments []dbCommentStruct
+	if err := r.Db.SelectContext(ctx, &dbComments, query, pq.Array(batchIDs(ids))); err != nil {
+		return nil, err
+	}
+
+	comments := make(map[string]*model.Comment, len(dbComments))
+	for _, c := range dbComments {
+		comment := toModelComment(c)
+		comments[comment.ID] = comment
 	}
 
 	return comments, nil
 }
 
-func (r *PostgresCommentRepository) CreateComment(ctx context.Context, input model.NewComment) (*model.Comment, error) {
-	//Ограничение на размерность текста сообщения
-	if len([]rune(input.Text)) > 2000 {
-		return nil, errors.New("text should not exceed 2000 characters")
+func (r *PostgresCommentRepository) CommentsByPosts(ctx context.Context, postIDs []string, sort model.CommentSort, first *int, after *string) (map[string]*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortOld)
+	if err != nil {
+		return nil, err
+	}
+	return r.commentsPages(ctx, `c.postid`, `c.replyto IS NULL`, postIDs, mode, first, after)
+}
+
+func (r *PostgresCommentRepository) RepliesByComments(ctx context.Context, commentIDs []string, sort model.CommentSort, first *int, after *string) (map[string]*model.CommentConnection, error) {
+	mode, err := commentSortMode(sort, sortOld)
+	if err != nil {
+		return nil, err
 	}
+	return r.commentsPages(ctx, `c.replyto`, "", commentIDs, mode, first, after)
+}
 
-	var isCommentingAvailable bool
-	postQuery := fmt.Sprintf(`SELECT isCommentingAvailable FROM %s WHERE id = $1`, postsTable)
-	err := r.Db.QueryRowContext(ctx, postQuery, input.PostID).Scan(&isCommentingAvailable)
+// commentsPages отдает одну страницу комментариев для каждого родителя одним запросом:
+// ROW_NUMBER в окне по родителю ограничивает страницу каждого из них.
+func (r *PostgresCommentRepository) commentsPages(ctx context.Context, parentColumn, filter string, parentIDs []string, mode sortMode, first *int, after *string) (map[string]*model.CommentConnection, error) {
+	size, c, err := pageArgs(first, after)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("post not found")
+		return nil, err
+	}
+
+	rank, _ := mode.rankSQL("c")
+	commentFields := `c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.username, c.editedat, c.deletedat, c.upvotes, c.downvotes, ` + rank + ` AS rank`
+
+	conditions := []string{parentColumn + ` = ANY($1)`}
+	if filter != "" {
+		conditions = append(conditions, filter)
+	}
+
+	args := []interface{}{pq.Array(batchIDs(parentIDs))}
+	if c != nil {
+		condition, cursorArgs, err := mode.afterSQL("c", len(args)+1, c)
+		if err != nil {
+			return nil, err
 		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	args = append(args, size+1)
+
+	query := fmt.Sprintf(`SELECT * FROM (
+                                  SELECT b.*, ROW_NUMBER() OVER (PARTITION BY b.parent ORDER BY %s) AS rn
+                                  FROM (SELECT %s, %s AS parent FROM %s c JOIN %s u on c.sender = u.id WHERE %s) b
+                              ) w WHERE w.rn <= $%d ORDER BY w.parent, w.rn`,
+		mode.orderSQL("b"), commentFields, parentColumn, commentsTable, usersTable, strings.Join(conditions, " AND "), len(args))
+
+	var dbComments []dbBatchCommentStruct
+	if err := r.Db.SelectContext(ctx, &dbComments, query, args...); err != nil {
 		return nil, err
 	}
 
-	if !isCommentingAvailable {
-		return nil, errors.New("commenting is not allowed on this post")
+	comments := make(map[string][]*model.Comment)
+	ranks := make(map[string][]float64)
+	for _, c := range dbComments {
+		parent := strconv.Itoa(c.Parent)
+		comments[parent] = append(comments[parent], toModelComment(c.dbCommentStruct))
+		ranks[parent] = append(ranks[parent], c.Rank)
+	}
+
+	connections := make(map[string]*model.CommentConnection, len(parentIDs))
+	for _, id := range parentIDs {
+		connections[id] = newCommentConnection(comments[id], ranks[id], size, mode)
+	}
+
+	return connections, nil
+}
+
+// CreateComment вызывает check и вставляет комментарий в одной транзакции. Строки поста и родителя
+// читаются FOR SHARE: закрытие комментариев, удаление поста или родителя ждут коммита вставки
+// и не проскакивают между проверкой и записью.
+func (r *PostgresCommentRepository) CreateComment(ctx context.Context, input model.NewComment, check CommentCheck) (*model.Comment, error) {
+	//Уведомление отправляется в той же транзакции, поэтому другие экземпляры сервиса
+	//узнают о комментарии только после его коммита
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	target, err := commentTarget(ctx, tx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := check(target); err != nil {
+		return nil, err
+	}
+
+	//Нечисловые id не найдены и отклоняются правилами, вставка их уже не видит
+	postId, err := strconv.Atoi(input.PostID)
+	if err != nil {
+		return nil, ErrPostNotFound
+	}
+	senderId, err := strconv.Atoi(input.SenderID)
+	if err != nil {
+		return nil, ErrUserNotFound
 	}
 
 	var query string
+	var args []interface{}
 	var commentId int
-	var createdAt string
+	var createdAt time.Time
 
 	fieldsWithNull := `postid, sender, text`
 	fields := `postid, sender, replyto, text`
 
 	if input.ReplyTo == nil {
 		query = fmt.Sprintf(`INSERT INTO %s (%s) VALUES ($1, $2, $3) RETURNING id, createdAt`, commentsTable, fieldsWithNull)
-		err := r.Db.QueryRowContext(ctx, query, input.PostID, input.SenderID, input.Text).Scan(&commentId, &createdAt)
+		args = []interface{}{postId, senderId, input.Text}
+	} else {
+		parentId, err := strconv.Atoi(*input.ReplyTo)
 		if err != nil {
-			return nil, err
+			return nil, ErrReplyToNotFound
 		}
+		query = fmt.Sprintf(`INSERT INTO %s (%s) VALUES ($1, $2, $3, $4) RETURNING id, createdAt`, commentsTable, fields)
+		args = []interface{}{postId, senderId, parentId, input.Text}
+	}
 
-		comment := &model.Comment{
-			ID:     strconv.Itoa(commentId),
-			PostID: input.PostID,
-			Sender: &model.User{
-				ID: input.SenderID,
-			},
-			ReplyTo:   nil,
-			Text:      input.Text,
-			CreatedAt: createdAt,
-		}
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&commentId, &createdAt); err != nil {
+		return nil, foreignKeyError(err)
+	}
 
-		return comment, nil
+	if err := notifyCommentAdded(ctx, tx, commentId, input.PostID); err != nil {
+		return nil, err
 	}
 
-	query = fmt.Sprintf(`INSERT INTO %s (%s) VALUES ($1, $2, $3, $4) RETURNING id, createdAt`, commentsTable, fields)
-	err = r.Db.QueryRowContext(ctx, query, input.PostID, input.SenderID, input.ReplyTo, input.Text).Scan(&commentId, &createdAt)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
@@ -123,12 +277,195 @@ func (r *PostgresCommentRepository) CreateComment(ctx context.Context, input mod
 		Sender: &model.User{
 			ID: input.SenderID,
 		},
-		ReplyTo: &model.Comment{
-			ID: *input.ReplyTo,
-		},
+		ReplyTo:   nil,
 		Text:      input.Text,
 		CreatedAt: createdAt,
 	}
 
+	if input.ReplyTo != nil {
+		comment.ReplyTo = &model.Comment{
+			ID: *input.ReplyTo,
+		}
+	}
+
 	return comment, nil
 }
+
+// commentTarget читает пост, отправителя и родителя нового комментария внутри транзакции вставки.
+// Записи с нечисловым id в базе быть не может, такие записи считаются отсутствующими.
+func commentTarget(ctx context.Context, tx *sqlx.Tx, input model.NewComment) (CommentTarget, error) {
+	var target CommentTarget
+
+	if postId, err := strconv.Atoi(input.PostID); err == nil {
+		post := &model.Post{ID: input.PostID}
+		query := fmt.Sprintf(`SELECT isCommentingAvailable, deletedAt FROM %s WHERE id = $1 FOR SHARE`, postsTable)
+		err := tx.QueryRowContext(ctx, query, postId).Scan(&post.IsCommentingAvailable, &post.DeletedAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return target, err
+		}
+		if err == nil {
+			target.Post = post
+		}
+	}
+
+	if senderId, err := strconv.Atoi(input.SenderID); err == nil {
+		sender := &model.User{ID: input.SenderID}
+		query := fmt.Sprintf(`SELECT username FROM %s WHERE id = $1`, usersTable)
+		err := tx.QueryRowContext(ctx, query, senderId).Scan(&sender.Username)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return target, err
+		}
+		if err == nil {
+			target.Sender = sender
+		}
+	}
+
+	if input.ReplyTo == nil {
+		return target, nil
+	}
+
+	if parentId, err := strconv.Atoi(*input.ReplyTo); err == nil {
+		var parentPostId int
+		query := fmt.Sprintf(`SELECT postid FROM %s WHERE id = $1 FOR SHARE`, commentsTable)
+		err := tx.QueryRowContext(ctx, query, parentId).Scan(&parentPostId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return target, err
+		}
+		if err == nil {
+			target.Parent = &model.Comment{ID: *input.ReplyTo, PostID: strconv.Itoa(parentPostId)}
+		}
+	}
+
+	return target, nil
+}
+
+func (r *PostgresCommentRepository) UpdateComment(ctx context.Context, id, userID, text string) (*model.Comment, error) {
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	commentId, err := checkCommentAuthor(ctx, tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET text = $2, editedAt = now() WHERE id = $1`, commentsTable)
+	if _, err := tx.ExecContext(ctx, query, commentId, text); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.commentByID(ctx, commentId)
+}
+
+func (r *PostgresCommentRepository) DeleteComment(ctx context.Context, id, userID string) error {
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	commentId, err := checkCommentAuthor(ctx, tx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	//Комментарий без ответов удаляем целиком, иначе оставляем надгробие, чтобы не рвать дерево
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM %s WHERE replyTo = $1)`,
+		commentsTable, commentsTable)
+	result, err := tx.ExecContext(ctx, deleteQuery, commentId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		tombstoneQuery := fmt.Sprintf(`UPDATE %s SET text = $2, deletedAt = now() WHERE id = $1`, commentsTable)
+		if _, err := tx.ExecContext(ctx, tombstoneQuery, commentId, model.DeletedText); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkCommentAuthor проверяет, что комментарий существует, не удален и принадлежит пользователю,
+// и блокирует строку до конца транзакции.
+func checkCommentAuthor(ctx context.Context, tx *sqlx.Tx, id, userID string) (int, error) {
+	commentId, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, ErrCommentNotFound
+	}
+
+	var sender *int
+	var deletedAt *string
+	query := fmt.Sprintf(`SELECT sender, deletedAt FROM %s WHERE id = $1 FOR UPDATE`, commentsTable)
+	if err := tx.QueryRowContext(ctx, query, commentId).Scan(&sender, &deletedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrCommentNotFound
+		}
+		return 0, err
+	}
+
+	if sender == nil || strconv.Itoa(*sender) != userID {
+		return 0, ErrNotCommentAuthor
+	}
+
+	if deletedAt != nil {
+		return 0, ErrCommentDeleted
+	}
+
+	return commentId, nil
+}
+
+// commentByID загружает комментарий вместе с отправителем.
+func (r *PostgresCommentRepository) commentByID(ctx context.Context, id int) (*model.Comment, error) {
+	commentFields := `c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.username, c.editedat, c.deletedat, c.upvotes, c.downvotes`
+	query := fmt.Sprintf(`SELECT %s FROM %s c JOIN %s u on c.sender = u.id WHERE c.id = $1`,
+		commentFields, commentsTable, usersTable)
+
+	var dbComment dbCommentStruct
+	if err := r.Db.GetContext(ctx, &dbComment, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	return toModelComment(dbComment), nil
+}
+
+func toModelComment(c dbCommentStruct) *model.Comment {
+	comment := &model.Comment{
+		ID:     strconv.Itoa(c.ID),
+		PostID: strconv.Itoa(c.PostID),
+		Sender: &model.User{
+			ID:       strconv.Itoa(c.SenderID),
+			Username: *c.Username,
+		},
+		ReplyTo:   nil,
+		Text:      c.Text,
+		CreatedAt: c.CreatedAt,
+		EditedAt:  c.EditedAt,
+		DeletedAt: c.DeletedAt,
+		Upvotes:   c.Upvotes,
+		Downvotes: c.Downvotes,
+	}
+
+	if c.ReplyTo != nil {
+		comment.ReplyTo = &model.Comment{
+			ID: strconv.Itoa(*c.ReplyTo),
+		}
+	}
+
+	return comment
+}
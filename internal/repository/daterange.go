@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"fmt"
+	"ozon-graphql-api/graph/model"
+	"time"
+)
+
+// inDateRange проверяет, попадает ли время в интервал [From, To). Пустые границы не ограничивают выборку.
+func inDateRange(period *model.DateRange, t time.Time) bool {
+	if period == nil {
+		return true
+	}
+	if period.From != nil && t.Before(*period.From) {
+		return false
+	}
+	if period.To != nil && !t.Before(*period.To) {
+		return false
+	}
+	return true
+}
+
+// dateRangeSQL возвращает условия на колонку column и их аргументы. Параметры нумеруются с $n.
+func dateRangeSQL(column string, n int, period *model.DateRange) ([]string, []interface{}) {
+	if period == nil {
+		return nil, nil
+	}
+
+	var conditions []string
+	var args []interface{}
+	if period.From != nil {
+		conditions = append(conditions, fmt.Sprintf("%s >= $%d", column, n+len(args)))
+		args = append(args, *period.From)
+	}
+	if period.To != nil {
+		conditions = append(conditions, fmt.Sprintf("%s < $%d", column, n+len(args)))
+		args = append(args, *period.To)
+	}
+	return conditions, args
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"ozon-graphql-api/internal/apperr"
+	"ozon-graphql-api/pkg/cursor"
+)
+
+// Ошибки, общие для обоих хранилищ: по ним клиент получает одинаковые сообщения и коды
+// независимо от того, с каким хранилищем запущен сервис.
+var (
+	ErrPostNotFound    = apperr.New(apperr.NotFound, "post not found")
+	ErrCommentNotFound = apperr.New(apperr.NotFound, "comment not found")
+	ErrUserNotFound    = apperr.New(apperr.NotFound, "user not found")
+	ErrReplyToNotFound = apperr.New(apperr.NotFound, "comment you want to reply to doesn't exist")
+
+	ErrNotPostAuthor    = apperr.New(apperr.Forbidden, "only the author can change the post")
+	ErrNotCommentAuthor = apperr.New(apperr.Forbidden, "only the author can change the comment")
+	ErrCommentingClosed = apperr.New(apperr.Forbidden, "commenting is not allowed on this post")
+
+	ErrPostDeleted    = apperr.New(apperr.Conflict, "post is deleted")
+	ErrCommentDeleted = apperr.New(apperr.Conflict, "comment is deleted")
+	ErrVoteForDeleted = apperr.New(apperr.Conflict, "can't vote for deleted content")
+	ErrUsernameTaken  = apperr.New(apperr.Conflict, "username already taken")
+
+	ErrInvalidCursor = apperr.Wrap(apperr.Validation, cursor.ErrInvalidCursor, "invalid cursor")
+	ErrNegativeFirst = apperr.New(apperr.Validation, "first should not be negative")
+	ErrFirstTooLarge = apperr.New(apperr.Validation, fmt.Sprintf("first should not be greater than %d", MaxPageSize))
+	ErrUnknownSearch = apperr.New(apperr.Validation, "unknown search type")
+)
+
+// Коды ошибок postgres
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// foreignKeyErrors сопоставляет внешние ключи схемы с ошибкой о несуществующей записи,
+// на которую ссылается вставка.
+var foreignKeyErrors = map[string]error{
+	"posts_createdby_fkey":  ErrUserNotFound,
+	"comments_postid_fkey":  ErrPostNotFound,
+	"comments_sender_fkey":  ErrUserNotFound,
+	"comments_replyto_fkey": ErrReplyToNotFound,
+	"votes_userid_fkey":     ErrUserNotFound,
+}
+
+// foreignKeyError возвращает доменную ошибку для нарушения внешнего ключа или исходную ошибку.
+func foreignKeyError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		if domainErr, ok := foreignKeyErrors[pqErr.Constraint]; ok {
+			return domainErr
+		}
+	}
+	return err
+}
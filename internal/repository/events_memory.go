@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"sync"
+)
+
+// MemoryCommentEvents доставляет события внутри процесса: in-memory хранилище
+// не разделяется между экземплярами сервиса.
+type MemoryCommentEvents struct {
+	mu       sync.RWMutex
+	handlers map[int]func(postID string, event model.CommentThreadEvent)
+	nextID   int
+}
+
+func NewMemoryCommentEvents() *MemoryCommentEvents {
+	return &MemoryCommentEvents{
+		handlers: make(map[int]func(postID string, event model.CommentThreadEvent)),
+	}
+}
+
+func (e *MemoryCommentEvents) Listen(ctx context.Context, handler func(postID string, event model.CommentThreadEvent)) error {
+	e.mu.Lock()
+	id := e.nextID
+	e.nextID++
+	e.handlers[id] = handler
+	e.mu.Unlock()
+
+	<-ctx.Done()
+
+	e.mu.Lock()
+	delete(e.handlers, id)
+	e.mu.Unlock()
+
+	return nil
+}
+
+func (e *MemoryCommentEvents) publish(postID string, event model.CommentThreadEvent) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, handler := range e.handlers {
+		handler(postID, event)
+	}
+}
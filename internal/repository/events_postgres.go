@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"log"
+	"ozon-graphql-api/graph/model"
+	"time"
+)
+
+const commentAddedChannel = "comment_added"
+
+const (
+	notificationCommentAdded           = "commentAdded"
+	notificationCommentingAvailability = "commentingAvailability"
+)
+
+// Полезная нагрузка NOTIFY ограничена 8000 байтами, поэтому для комментария передаем только
+// идентификаторы, а сам комментарий слушатель догружает из базы.
+type commentNotification struct {
+	Type      string `json:"type"`
+	ID        int    `json:"id,omitempty"`
+	PostID    string `json:"postId"`
+	Available bool   `json:"available,omitempty"`
+}
+
+func notifyCommentAdded(ctx context.Context, db sqlx.ExecerContext, commentId int, postID string) error {
+	return notify(ctx, db, commentNotification{Type: notificationCommentAdded, ID: commentId, PostID: postID})
+}
+
+func notifyCommentingAvailability(ctx context.Context, db sqlx.ExecerContext, postID string, available bool) error {
+	return notify(ctx, db, commentNotification{Type: notificationCommentingAvailability, PostID: postID, Available: available})
+}
+
+func notify(ctx context.Context, db sqlx.ExecerContext, notification commentNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, commentAddedChannel, string(payload))
+	return err
+}
+
+// PostgresCommentEvents получает уведомления о комментариях, созданных любым экземпляром сервиса,
+// и об открытии или закрытии комментариев к постам.
+type PostgresCommentEvents struct {
+	Listener *pq.Listener
+	Comments *PostgresCommentRepository
+}
+
+func NewPostgresCommentEvents(listener *pq.Listener, comments *PostgresCommentRepository) *PostgresCommentEvents {
+	return &PostgresCommentEvents{
+		Listener: listener,
+		Comments: comments,
+	}
+}
+
+func (e *PostgresCommentEvents) Listen(ctx context.Context, handler func(postID string, event model.CommentThreadEvent)) error {
+	if err := e.Listener.Listen(commentAddedChannel); err != nil {
+		return err
+	}
+	defer e.Listener.Unlisten(commentAddedChannel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-e.Listener.Notify:
+			//nil приходит после переподключения, часть уведомлений могла потеряться
+			if n == nil {
+				log.Println("comment events listener reconnected")
+				continue
+			}
+
+			var notification commentNotification
+			if err := json.Unmarshal([]byte(n.Extra), &notification); err != nil {
+				log.Printf("bad comment notification %q: %v", n.Extra, err)
+				continue
+			}
+
+			if notification.Type == notificationCommentingAvailability {
+				handler(notification.PostID, &model.CommentingAvailabilityChanged{
+					PostID:                notification.PostID,
+					IsCommentingAvailable: notification.Available,
+				})
+				continue
+			}
+
+			comment, err := e.Comments.commentByID(ctx, notification.ID)
+			if err != nil {
+				log.Printf("error loading comment %d: %v", notification.ID, err)
+				continue
+			}
+
+			handler(comment.PostID, comment)
+		case <-time.After(90 * time.Second):
+			//Проверяем, что соединение живо, если уведомлений давно не было
+			go e.Listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/pkg/cursor"
+	"strconv"
+	"time"
+)
+
+const defaultPageSize = 25
+
+// MaxPageSize - наибольшее значение first: страница целиком собирается в памяти, а в postgres
+// уходит в LIMIT, поэтому без ограничения один запрос мог бы выбрать всю ленту.
+const MaxPageSize = 100
+
+// pageArgs разбирает аргументы first/after. Курсор nil означает начало ленты.
+func pageArgs(first *int, after *string) (int, *cursor.Cursor, error) {
+	size := defaultPageSize
+	if first != nil {
+		size = *first
+	}
+	if size < 0 {
+		return 0, nil, ErrNegativeFirst
+	}
+	if size > MaxPageSize {
+		return 0, nil, ErrFirstTooLarge
+	}
+
+	if after == nil || *after == "" {
+		return size, nil, nil
+	}
+
+	c, err := cursor.Decode(*after)
+	if err != nil {
+		return 0, nil, ErrInvalidCursor
+	}
+
+	return size, &c, nil
+}
+
+// cursorID разбирает id из курсора ленты в базе: id там числовые, и нечисловой id - испорченный курсор.
+func cursorID(c *cursor.Cursor) (int, error) {
+	id, err := strconv.Atoi(c.ID)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// cursorTime разбирает время создания из курсора ленты.
+func cursorTime(c *cursor.Cursor) (time.Time, error) {
+	createdAt, err := model.ParseTimestamp(c.CreatedAt)
+	if err != nil {
+		return time.Time{}, ErrInvalidCursor
+	}
+	return createdAt, nil
+}
+
+// newPostConnection ожидает на вход до size+1 записей: лишняя запись говорит о том,
+// что есть следующая страница, и в ответ не попадает. ranks нужны только для лент по рейтингу.
+func newPostConnection(posts []*model.Post, ranks []float64, size int, mode sortMode) *model.PostConnection {
+	hasNextPage := len(posts) > size
+	if hasNextPage {
+		posts = posts[:size]
+	}
+
+	connection := &model.PostConnection{
+		Edges:    make([]*model.PostEdge, 0, len(posts)),
+		PageInfo: &model.PageInfo{HasNextPage: hasNextPage},
+	}
+
+	for i, post := range posts {
+		connection.Edges = append(connection.Edges, &model.PostEdge{
+			Cursor: mode.encodeCursor(rankAt(ranks, i), post.CreatedAt, post.ID),
+			Node:   post,
+		})
+	}
+
+	if len(connection.Edges) > 0 {
+		endCursor := connection.Edges[len(connection.Edges)-1].Cursor
+		connection.PageInfo.EndCursor = &endCursor
+	}
+
+	return connection
+}
+
+func newCommentConnection(comments []*model.Comment, ranks []float64, size int, mode sortMode) *model.CommentConnection {
+	hasNextPage := len(comments) > size
+	if hasNextPage {
+		comments = comments[:size]
+	}
+
+	connection := &model.CommentConnection{
+		Edges:    make([]*model.CommentEdge, 0, len(comments)),
+		PageInfo: &model.PageInfo{HasNextPage: hasNextPage},
+	}
+
+	for i, comment := range comments {
+		connection.Edges = append(connection.Edges, &model.CommentEdge{
+			Cursor: mode.encodeCursor(rankAt(ranks, i), comment.CreatedAt, comment.ID),
+			Node:   comment,
+		})
+	}
+
+	if len(connection.Edges) > 0 {
+		endCursor := connection.Edges[len(connection.Edges)-1].Cursor
+		connection.PageInfo.EndCursor = &endCursor
+	}
+
+	return connection
+}
+
+// newUserConnection: пользователи упорядочены по id, поэтому курсор содержит только id.
+func newUserConnection(users []*model.User, size int) *model.UserConnection {
+	hasNextPage := len(users) > size
+	if hasNextPage {
+		users = users[:size]
+	}
+
+	connection := &model.UserConnection{
+		Edges:    make([]*model.UserEdge, 0, len(users)),
+		PageInfo: &model.PageInfo{HasNextPage: hasNextPage},
+	}
+
+	for _, user := range users {
+		connection.Edges = append(connection.Edges, &model.UserEdge{
+			Cursor: cursor.Encode("", user.ID),
+			Node:   user,
+		})
+	}
+
+	if len(connection.Edges) > 0 {
+		endCursor := connection.Edges[len(connection.Edges)-1].Cursor
+		connection.PageInfo.EndCursor = &endCursor
+	}
+
+	return connection
+}
+
+func rankAt(ranks []float64, i int) float64 {
+	if i < len(ranks) {
+		return ranks[i]
+	}
+	return 0
+}
+
+func postSortKey(mode sortMode) func(post *model.Post) sortKey {
+	return func(post *model.Post) sortKey {
+		return sortKey{
+			Rank:      mode.rank(post.CreatedAt, post.Upvotes, post.Downvotes),
+			CreatedAt: post.CreatedAt,
+			ID:        post.ID,
+		}
+	}
+}
+
+func commentSortKey(mode sortMode) func(comment *model.Comment) sortKey {
+	return func(comment *model.Comment) sortKey {
+		return sortKey{
+			Rank:      mode.rank(comment.CreatedAt, comment.Upvotes, comment.Downvotes),
+			CreatedAt: comment.CreatedAt,
+			ID:        comment.ID,
+		}
+	}
+}
@@ -2,112 +2,248 @@ package repository
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"ozon-graphql-api/graph/model"
 	"ozon-graphql-api/pkg/memory"
-	"sort"
 	"strconv"
 	"time"
 )
 
 type MemoryPostRepository struct {
 	Storage *memory.Storage
+	Events  *MemoryCommentEvents
 }
 
-func NewMemoryPostRepo(storage *memory.Storage) *MemoryPostRepository {
+func NewMemoryPostRepo(storage *memory.Storage, events *MemoryCommentEvents) *MemoryPostRepository {
 	return &MemoryPostRepository{
 		Storage: storage,
+		Events:  events,
 	}
 }
 
-func (r *MemoryPostRepository) Posts(ctx context.Context, limit, offset *int) ([]*model.Post, error) {
-	r.Storage.Mu.RLock()
-	defer r.Storage.Mu.RUnlock()
+func (r *MemoryPostRepository) Posts(ctx context.Context, sort model.PostSort, createdAt *model.DateRange, first *int, after *string) (*model.PostConnection, error) {
+	mode, err := postSortMode(sort)
+	if err != nil {
+		return nil, err
+	}
+	return r.postsPage(nil, createdAt, mode, first, after)
+}
+
+func (r *MemoryPostRepository) PostsByUser(ctx context.Context, userID string, first *int, after *string) (*model.PostConnection, error) {
+	return r.postsPage(func(post *model.Post) bool {
+		return post.CreatedBy != nil && post.CreatedBy.ID == userID
+	}, nil, sortNew, first, after)
+}
 
-	var posts []*model.Post
-	for _, post := range r.Storage.Posts {
-		posts = append(posts, post)
+func (r *MemoryPostRepository) postsPage(match func(post *model.Post) bool, createdAt *model.DateRange, mode sortMode, first *int, after *string) (*model.PostConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
 	}
 
-	//Т.к. обход мап в гошке случайный, отсортируем нашу мапу по дате добавления для красивого вывода
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].CreatedAt > posts[j].CreatedAt
+	var connection *model.PostConnection
+	err = r.Storage.View(func(tx *memory.Tx) error {
+		page, ranks, err := orderedPage(tx.PostsByTime(), tx.Posts, match, createdAt, postSortKey(mode), mode, c, size)
+		if err != nil {
+			return err
+		}
+
+		for i, post := range page {
+			page[i] = memory.CopyPost(post)
+		}
+		connection = newPostConnection(page, ranks, size, mode)
+		return nil
 	})
 
-	start := *offset
-	end := start + *limit
+	return connection, err
+}
+
+func (r *MemoryPostRepository) PostByID(ctx context.Context, id int) (*model.Post, error) {
+	var post *model.Post
+	err := r.Storage.View(func(tx *memory.Tx) error {
+		stored, exists := tx.Posts[strconv.Itoa(id)]
+		if !exists {
+			return ErrPostNotFound
+		}
+
+		post = memory.CopyPost(stored)
+		return nil
+	})
+
+	return post, err
+}
 
-	if end > len(posts) {
-		end = len(posts)
+// CreatePost только сохраняет пост, автора проверяет service.PostService.
+func (r *MemoryPostRepository) CreatePost(ctx context.Context, input model.NewPost) (*model.Post, error) {
+	var post *model.Post
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		user, ok := tx.Users[input.UserID]
+		if !ok {
+			user = &model.User{ID: input.UserID}
+		}
+
+		tx.PostIdCounter++
+		postId := strconv.Itoa(tx.PostIdCounter)
+
+		newPost := &model.Post{
+			ID:                    postId,
+			Title:                 input.Title,
+			Text:                  input.Text,
+			CreatedBy:             user,
+			CreatedAt:             time.Now().UTC(),
+			IsCommentingAvailable: input.IsCommentingAvailable == nil || *input.IsCommentingAvailable,
+		}
+
+		tx.PutPost(newPost)
+		tx.Record(memory.PostSaved(newPost))
+
+		post = memory.CopyPost(newPost)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if start > len(posts) {
-		return []*model.Post{}, nil
+	return post, nil
+}
+
+func (r *MemoryPostRepository) UpdatePost(ctx context.Context, id, userID string, input model.UpdatePost) (*model.Post, error) {
+	var updated *model.Post
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		post, err := r.checkAuthor(tx, id, userID)
+		if err != nil {
+			return err
+		}
+
+		if input.Title != nil {
+			post.Title = *input.Title
+		}
+		if input.Text != nil {
+			post.Text = *input.Text
+		}
+		editedAt := time.Now().UTC()
+		post.EditedAt = &editedAt
+		tx.IndexPost(post)
+		tx.Record(memory.PostSaved(post))
+
+		updated = memory.CopyPost(post)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return posts[start:end], nil
+	return updated, nil
 }
 
-func (r *MemoryPostRepository) PostByID(ctx context.Context, id int) (*model.Post, error) {
-	r.Storage.Mu.RLock()
-	defer r.Storage.Mu.RUnlock()
+func (r *MemoryPostRepository) DeletePost(ctx context.Context, id, userID string) error {
+	return r.Storage.Update(func(tx *memory.Tx) error {
+		post, err := r.checkAuthor(tx, id, userID)
+		if err != nil {
+			return err
+		}
+
+		//Пост без комментариев удаляем целиком, иначе оставляем надгробие, чтобы обсуждение не потерялось.
+		//Комментарий первого уровня удаляется целиком только без ответов, поэтому у поста с ответами он остается.
+		if tx.RootComments(id).Len() > 0 {
+			deletedAt := time.Now().UTC()
+			post.Title = model.DeletedText
+			post.Text = model.DeletedText
+			post.IsCommentingAvailable = false
+			post.DeletedAt = &deletedAt
+			tx.IndexPost(post)
+			tx.Record(memory.PostSaved(post))
+			return nil
+		}
+
+		tx.DeletePost(id)
+		tx.Record(memory.PostDeleted(id))
+		return nil
+	})
+}
+
+func (r *MemoryPostRepository) SetCommentingAvailable(ctx context.Context, id, userID string, available bool) (*model.Post, error) {
+	var updated *model.Post
+	var changed bool
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		post, err := r.checkAuthor(tx, id, userID)
+		if err != nil {
+			return err
+		}
+
+		changed = post.IsCommentingAvailable != available
+		post.IsCommentingAvailable = available
+		tx.Record(memory.PostSaved(post))
+
+		updated = memory.CopyPost(post)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	post, exists := r.Storage.Posts[strconv.Itoa(id)]
-	if !exists {
-		return nil, fmt.Errorf("post with id %d not found", id)
+	if changed {
+		r.publishAvailability(id, available)
 	}
 
-	var rootComments []*model.Comment
-	for _, comment := range r.Storage.Comments {
-		if comment.PostID == strconv.Itoa(id) && comment.ReplyTo == nil {
-			rootComments = append(rootComments, comment)
+	return updated, nil
+}
+
+func (r *MemoryPostRepository) CloseCommentingOlderThan(ctx context.Context, age time.Duration) ([]string, error) {
+	deadline := time.Now().Add(-age)
+
+	var closed []string
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		for id, post := range tx.Posts {
+			if !post.IsCommentingAvailable || post.DeletedAt != nil {
+				continue
+			}
+
+			if !post.CreatedAt.Before(deadline) {
+				continue
+			}
+
+			post.IsCommentingAvailable = false
+			closed = append(closed, id)
+			tx.Record(memory.PostSaved(post))
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	resultPost := &model.Post{
-		ID:                    post.ID,
-		Title:                 post.Title,
-		Text:                  post.Text,
-		CreatedAt:             post.CreatedAt,
-		IsCommentingAvailable: post.IsCommentingAvailable,
-		CreatedBy: &model.User{
-			ID:       post.CreatedBy.ID,
-			Username: post.CreatedBy.Username,
-		},
-		Comments: rootComments,
+	for _, id := range closed {
+		r.publishAvailability(id, false)
 	}
 
-	return resultPost, nil
+	return closed, nil
 }
 
-func (r *MemoryPostRepository) CreatePost(ctx context.Context, input model.NewPost) (*model.Post, error) {
-	//Проверка существования пользователя
-	r.Storage.Mu.RLock()
-	user, ok := r.Storage.Users[input.UserID]
-	r.Storage.Mu.RUnlock()
+func (r *MemoryPostRepository) publishAvailability(postID string, available bool) {
+	if r.Events == nil {
+		return
+	}
+
+	r.Events.publish(postID, &model.CommentingAvailabilityChanged{
+		PostID:                postID,
+		IsCommentingAvailable: available,
+	})
+}
+
+// checkAuthor вызывается внутри транзакции хранилища.
+func (r *MemoryPostRepository) checkAuthor(tx *memory.Tx, id, userID string) (*model.Post, error) {
+	post, ok := tx.Posts[id]
 	if !ok {
-		return nil, errors.New("user doesn't exists")
+		return nil, ErrPostNotFound
 	}
 
-	r.Storage.Mu.Lock()
-	postId := r.Storage.PostIdCounter + 1
-	r.Storage.PostIdCounter = postId
-	r.Storage.Mu.Unlock()
-
-	newPost := &model.Post{
-		ID:                    strconv.Itoa(postId),
-		Title:                 input.Title,
-		Text:                  input.Text,
-		CreatedBy:             user,
-		CreatedAt:             time.Now().Format(time.RFC3339),
-		IsCommentingAvailable: *input.IsCommentingAvailable,
-		Comments:              []*model.Comment{},
+	if post.CreatedBy == nil || post.CreatedBy.ID != userID {
+		return nil, ErrNotPostAuthor
 	}
 
-	r.Storage.Mu.Lock()
-	r.Storage.Posts[strconv.Itoa(postId)] = newPost
-	r.Storage.Mu.Unlock()
+	if post.DeletedAt != nil {
+		return nil, ErrPostDeleted
+	}
 
-	return newPost, nil
+	return post, nil
 }
@@ -2,10 +2,14 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"ozon-graphql-api/graph/model"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type PostgresPostRepository struct {
@@ -18,25 +22,64 @@ func NewPostgresPostRepo(db *sqlx.DB) *PostgresPostRepository {
 	}
 }
 
-func (r *PostgresPostRepository) Posts(ctx context.Context, limit, offset *int) ([]*model.Post, error) {
-	queryLimit := *limit
-	queryOffset := *offset
+func (r *PostgresPostRepository) Posts(ctx context.Context, sort model.PostSort, createdAt *model.DateRange, first *int, after *string) (*model.PostConnection, error) {
+	mode, err := postSortMode(sort)
+	if err != nil {
+		return nil, err
+	}
+	conditions, args := dateRangeSQL("p.createdAt", 1, createdAt)
+	return r.postsPage(ctx, strings.Join(conditions, " AND "), args, mode, first, after)
+}
 
-	postFields := `p.id, p.title, p.text, p.createdAt, p.isCommentingAvailable, u.id as userId, u.username`
+func (r *PostgresPostRepository) PostsByUser(ctx context.Context, userID string, first *int, after *string) (*model.PostConnection, error) {
+	return r.postsPage(ctx, `p.createdBy = $1`, []interface{}{userID}, sortNew, first, after)
+}
 
-	query := fmt.Sprintf(`SELECT %s FROM %s p JOIN %s u ON p.createdBy = u.id 
-                              ORDER BY p.createdAt DESC LIMIT $1 OFFSET $2`,
-		postFields, postsTable, usersTable)
+// postsPage отдает ленту постов в порядке mode. Параметры filter нумеруются с $1 и передаются в args.
+func (r *PostgresPostRepository) postsPage(ctx context.Context, filter string, args []interface{}, mode sortMode, first *int, after *string) (*model.PostConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	rank, _ := mode.rankSQL("p")
+	postFields := `p.id, p.title, p.text, p.createdAt, p.isCommentingAvailable, u.id as userId, u.username, p.editedAt, p.deletedAt, p.upvotes, p.downvotes, ` + rank + ` AS rank`
+
+	var conditions []string
+	if filter != "" {
+		conditions = append(conditions, filter)
+	}
+
+	//Keyset-пагинация: курсор (rank, createdAt, id) не сдвигается при появлении новых постов
+	if c != nil {
+		condition, cursorArgs, err := mode.afterSQL("p", len(args)+1, c)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	args = append(args, size+1)
+
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s p JOIN %s u ON p.createdBy = u.id %s
+                              ORDER BY %s LIMIT $%d`,
+		postFields, postsTable, usersTable, where, mode.orderSQL("p"), len(args))
 
 	// Промежуточная структура для маппинга
 	var dbPosts []dbPostStruct
 
-	err := r.Db.SelectContext(ctx, &dbPosts, query, queryLimit, queryOffset)
+	err = r.Db.SelectContext(ctx, &dbPosts, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	var posts []*model.Post
+	var ranks []float64
 
 	for _, dbPost := range dbPosts {
 		//Заполняем данные о посте
@@ -47,6 +90,10 @@ func (r *PostgresPostRepository) Posts(ctx context.Context, limit, offset *int)
 			Text:                  dbPost.Text,
 			CreatedAt:             dbPost.CreatedAt,
 			IsCommentingAvailable: dbPost.IsCommentingAvailable,
+			EditedAt:              dbPost.EditedAt,
+			DeletedAt:             dbPost.DeletedAt,
+			Upvotes:               dbPost.Upvotes,
+			Downvotes:             dbPost.Downvotes,
 		}
 
 		//Дописываем в модель информацию о пользователе
@@ -59,78 +106,23 @@ func (r *PostgresPostRepository) Posts(ctx context.Context, limit, offset *int)
 		}
 
 		posts = append(posts, post)
+		ranks = append(ranks, dbPost.Rank)
 	}
 
-	return posts, nil
+	return newPostConnection(posts, ranks, size, mode), nil
 }
 
 func (r *PostgresPostRepository) PostByID(ctx context.Context, id int) (*model.Post, error) {
-	postFields := `p.id, p.title, p.text, p.createdAt, p.isCommentingAvailable, u.id as userId, u.username`
+	postFields := `p.id, p.title, p.text, p.createdAt, p.isCommentingAvailable, u.id as userId, u.username, p.editedAt, p.deletedAt, p.upvotes, p.downvotes`
 	postQuery := fmt.Sprintf(`SELECT %s FROM %s p JOIN %s u ON p.createdBy = u.id WHERE p.id = $1`,
 		postFields, postsTable, usersTable)
 
 	var dbPost dbPostStruct
 	if err := r.Db.GetContext(ctx, &dbPost, postQuery, id); err != nil {
-		return nil, fmt.Errorf("error fetching post: %w", err)
-	}
-
-	// Рекурсивный обход комментариев для конкретного поста
-	fields := `c.id, c.text, c.replyTo, c.sender, c.createdAt`
-	name := `comment_tree`
-	ctFields := `ct.id, ct.text, ct.replyto, ct.sender, ct.createdat, u.id as userid, u.username`
-	commentQuery := fmt.Sprintf(`
-    WITH RECURSIVE %s AS (
-        SELECT %s
-        FROM %s c
-        WHERE c.postId = $1 AND c.replyTo IS NULL
-        UNION ALL
-        SELECT %s
-        FROM %s c
-        INNER JOIN %s ct ON c.replyTo = ct.id
-    )
-    SELECT %s FROM %s ct
-    JOIN %s u ON ct.sender = u.id
-    ORDER BY createdAt;`,
-		name, fields, commentsTable, fields, commentsTable, name,
-		ctFields, name, usersTable)
-
-	// Промежуточная структура для маппинга
-	var dbComments []dbCommentStruct
-	if err := r.Db.SelectContext(ctx, &dbComments, commentQuery, id); err != nil {
-		return nil, err
-	}
-
-	// Преобразование в иерархическую структуру
-	commentMap := make(map[int]*model.Comment)
-	var rootComments []*model.Comment
-
-	for _, c := range dbComments {
-		comment := &model.Comment{
-			ID:        strconv.Itoa(c.ID),
-			PostID:    strconv.Itoa(c.PostID),
-			Text:      c.Text,
-			ReplyTo:   nil,
-			CreatedAt: c.CreatedAt,
-			Sender: &model.User{
-				ID:       strconv.Itoa(c.SenderID),
-				Username: *c.Username,
-			},
-			Replies: []*model.Comment{},
-		}
-		commentMap[c.ID] = comment
-	}
-
-	for _, c := range dbComments {
-		comment := commentMap[c.ID]
-		if c.ReplyTo != nil {
-			parent, exists := commentMap[*c.ReplyTo]
-			if exists {
-				comment.ReplyTo = parent
-				parent.Replies = append(parent.Replies, comment)
-			}
-		} else {
-			rootComments = append(rootComments, comment)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
 		}
+		return nil, err
 	}
 
 	postId := strconv.Itoa(dbPost.ID)
@@ -140,11 +132,14 @@ func (r *PostgresPostRepository) PostByID(ctx context.Context, id int) (*model.P
 		Text:                  dbPost.Text,
 		CreatedAt:             dbPost.CreatedAt,
 		IsCommentingAvailable: dbPost.IsCommentingAvailable,
+		EditedAt:              dbPost.EditedAt,
+		DeletedAt:             dbPost.DeletedAt,
+		Upvotes:               dbPost.Upvotes,
+		Downvotes:             dbPost.Downvotes,
 		CreatedBy: &model.User{
 			ID:       strconv.Itoa(*dbPost.UserID),
 			Username: *dbPost.Username,
 		},
-		Comments: rootComments,
 	}
 
 	return post, nil
@@ -157,12 +152,13 @@ func (r *PostgresPostRepository) CreatePost(ctx context.Context, input model.New
 		postsTable, postFields)
 
 	var postId int
-	var createdAt string
+	var createdAt time.Time
+	available := input.IsCommentingAvailable == nil || *input.IsCommentingAvailable
 
 	err := r.Db.QueryRowContext(ctx, query,
-		input.Title, input.Text, input.UserID, input.IsCommentingAvailable).Scan(&postId, &createdAt)
+		input.Title, input.Text, input.UserID, available).Scan(&postId, &createdAt)
 	if err != nil {
-		return nil, err
+		return nil, foreignKeyError(err)
 	}
 
 	id := strconv.Itoa(postId)
@@ -171,7 +167,7 @@ func (r *PostgresPostRepository) CreatePost(ctx context.Context, input model.New
 		Title:                 input.Title,
 		Text:                  input.Text,
 		CreatedAt:             createdAt,
-		IsCommentingAvailable: *input.IsCommentingAvailable,
+		IsCommentingAvailable: available,
 		CreatedBy: &model.User{
 			ID: input.UserID,
 		},
@@ -179,3 +175,161 @@ func (r *PostgresPostRepository) CreatePost(ctx context.Context, input model.New
 
 	return post, nil
 }
+
+func (r *PostgresPostRepository) UpdatePost(ctx context.Context, id, userID string, input model.UpdatePost) (*model.Post, error) {
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	postId, err := checkPostAuthor(ctx, tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET title = COALESCE($2, title), text = COALESCE($3, text), editedAt = now()
+                              WHERE id = $1`, postsTable)
+	if _, err := tx.ExecContext(ctx, query, postId, input.Title, input.Text); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.PostByID(ctx, postId)
+}
+
+func (r *PostgresPostRepository) DeletePost(ctx context.Context, id, userID string) error {
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	postId, err := checkPostAuthor(ctx, tx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	//Пост без комментариев удаляем целиком, иначе оставляем надгробие, чтобы обсуждение не потерялось
+	deleteQuery := fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM %s WHERE postId = $1)`,
+		postsTable, commentsTable)
+	result, err := tx.ExecContext(ctx, deleteQuery, postId)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		tombstoneQuery := fmt.Sprintf(`UPDATE %s SET title = $2, text = $2, isCommentingAvailable = false, deletedAt = now()
+                                       WHERE id = $1`, postsTable)
+		if _, err := tx.ExecContext(ctx, tombstoneQuery, postId, model.DeletedText); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresPostRepository) SetCommentingAvailable(ctx context.Context, id, userID string, available bool) (*model.Post, error) {
+	//Уведомление уходит в той же транзакции и только если значение действительно поменялось
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	postId, err := checkPostAuthor(ctx, tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET isCommentingAvailable = $2 WHERE id = $1 AND isCommentingAvailable <> $2`, postsTable)
+	result, err := tx.ExecContext(ctx, query, postId, available)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if changed > 0 {
+		if err := notifyCommentingAvailability(ctx, tx, id, available); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.PostByID(ctx, postId)
+}
+
+func (r *PostgresPostRepository) CloseCommentingOlderThan(ctx context.Context, age time.Duration) ([]string, error) {
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE %s SET isCommentingAvailable = false
+                              WHERE isCommentingAvailable AND deletedAt IS NULL AND createdAt < $1 RETURNING id`, postsTable)
+
+	var postIds []int
+	if err := tx.SelectContext(ctx, &postIds, query, time.Now().Add(-age)); err != nil {
+		return nil, err
+	}
+
+	var closed []string
+	for _, postId := range postIds {
+		id := strconv.Itoa(postId)
+		if err := notifyCommentingAvailability(ctx, tx, id, false); err != nil {
+			return nil, err
+		}
+		closed = append(closed, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return closed, nil
+}
+
+// checkPostAuthor проверяет, что пост существует, не удален и принадлежит пользователю, и блокирует
+// строку до конца транзакции, чтобы параллельное удаление не вклинилось между проверкой и записью.
+func checkPostAuthor(ctx context.Context, tx *sqlx.Tx, id, userID string) (int, error) {
+	postId, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, ErrPostNotFound
+	}
+
+	var createdBy *int
+	var deletedAt *string
+	query := fmt.Sprintf(`SELECT createdBy, deletedAt FROM %s WHERE id = $1 FOR UPDATE`, postsTable)
+	if err := tx.QueryRowContext(ctx, query, postId).Scan(&createdBy, &deletedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrPostNotFound
+		}
+		return 0, err
+	}
+
+	if createdBy == nil || strconv.Itoa(*createdBy) != userID {
+		return 0, ErrNotPostAuthor
+	}
+
+	if deletedAt != nil {
+		return 0, ErrPostDeleted
+	}
+
+	return postId, nil
+}
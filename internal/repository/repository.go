@@ -3,57 +3,153 @@ package repository
 import (
 	"context"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"ozon-graphql-api/graph/model"
 	"ozon-graphql-api/pkg/memory"
+	"time"
 )
 
 type dbPostStruct struct {
-	ID                    int     `db:"id"`
-	Title                 string  `db:"title"`
-	Text                  string  `db:"text"`
-	CreatedAt             string  `db:"createdat"`
-	IsCommentingAvailable bool    `db:"iscommentingavailable"`
-	UserID                *int    `db:"userid"`
-	Username              *string `db:"username"`
+	ID                    int        `db:"id"`
+	Title                 string     `db:"title"`
+	Text                  string     `db:"text"`
+	CreatedAt             time.Time  `db:"createdat"`
+	Rank                  float64    `db:"rank"`
+	IsCommentingAvailable bool       `db:"iscommentingavailable"`
+	EditedAt              *time.Time `db:"editedat"`
+	DeletedAt             *time.Time `db:"deletedat"`
+	Upvotes               int        `db:"upvotes"`
+	Downvotes             int        `db:"downvotes"`
+	UserID                *int       `db:"userid"`
+	Username              *string    `db:"username"`
 }
 
 type dbCommentStruct struct {
-	ID        int     `db:"id"`
-	PostID    int     `db:"postid"`
-	Text      string  `db:"text"`
-	ReplyTo   *int    `db:"replyto"`
-	SenderID  int     `db:"sender"`
-	CreatedAt string  `db:"createdat"`
-	UserID    *int    `db:"userid"`
-	Username  *string `db:"username"`
+	ID        int        `db:"id"`
+	PostID    int        `db:"postid"`
+	Text      string     `db:"text"`
+	ReplyTo   *int       `db:"replyto"`
+	SenderID  int        `db:"sender"`
+	CreatedAt time.Time  `db:"createdat"`
+	Rank      float64    `db:"rank"`
+	EditedAt  *time.Time `db:"editedat"`
+	DeletedAt *time.Time `db:"deletedat"`
+	Upvotes   int        `db:"upvotes"`
+	Downvotes int        `db:"downvotes"`
+	UserID    *int       `db:"userid"`
+	Username  *string    `db:"username"`
+}
+
+// dbBatchCommentStruct - комментарий из пакетного запроса вместе с id родителя и номером в его странице
+type dbBatchCommentStruct struct {
+	dbCommentStruct
+	Parent    int `db:"parent"`
+	RowNumber int `db:"rn"`
+}
+
+type dbUserStruct struct {
+	ID       int    `db:"id"`
+	Username string `db:"username"`
 }
 
 type PostRepository interface {
-	Posts(ctx context.Context, limit, offset *int) ([]*model.Post, error)
+	// Posts отдает ленту постов, createdAt ограничивает время создания
+	Posts(ctx context.Context, sort model.PostSort, createdAt *model.DateRange, first *int, after *string) (*model.PostConnection, error)
+	PostsByUser(ctx context.Context, userID string, first *int, after *string) (*model.PostConnection, error)
 	PostByID(ctx context.Context, id int) (*model.Post, error)
 	CreatePost(ctx context.Context, input model.NewPost) (*model.Post, error)
+	UpdatePost(ctx context.Context, id, userID string, input model.UpdatePost) (*model.Post, error)
+	DeletePost(ctx context.Context, id, userID string) error
+	SetCommentingAvailable(ctx context.Context, id, userID string, available bool) (*model.Post, error)
+	// CloseCommentingOlderThan закрывает комментарии у постов старше age и возвращает их id
+	CloseCommentingOlderThan(ctx context.Context, age time.Duration) ([]string, error)
 }
 
 type CommentRepository interface {
-	Comments(ctx context.Context, limit, offset *int) ([]*model.Comment, error)
-	CreateComment(ctx context.Context, input model.NewComment) (*model.Comment, error)
+	Comments(ctx context.Context, sort model.CommentSort, createdAt *model.DateRange, first *int, after *string) (*model.CommentConnection, error)
+	CommentsByPost(ctx context.Context, postID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error)
+	RepliesByComment(ctx context.Context, commentID string, sort model.CommentSort, first *int, after *string) (*model.CommentConnection, error)
+	CommentsByUser(ctx context.Context, userID string, first *int, after *string) (*model.CommentConnection, error)
+	// CommentsByIDs, CommentsByPosts и RepliesByComments - пакетные варианты для загрузчиков:
+	// один запрос на все родительские записи
+	CommentsByIDs(ctx context.Context, ids []string) (map[string]*model.Comment, error)
+	CommentsByPosts(ctx context.Context, postIDs []string, sort model.CommentSort, first *int, after *string) (map[string]*model.CommentConnection, error)
+	RepliesByComments(ctx context.Context, commentIDs []string, sort model.CommentSort, first *int, after *string) (map[string]*model.CommentConnection, error)
+	// CreateComment вызывает check внутри транзакции вставки и вставляет комментарий, только если check
+	// вернул nil: правила проверяет сервис, а репозиторий гарантирует, что записи не изменятся до записи
+	CreateComment(ctx context.Context, input model.NewComment, check CommentCheck) (*model.Comment, error)
+	UpdateComment(ctx context.Context, id, userID, text string) (*model.Comment, error)
+	DeleteComment(ctx context.Context, id, userID string) error
+}
+
+// CommentTarget - записи, к которым привязывается новый комментарий, прочитанные в транзакции вставки.
+// Отсутствующая запись - nil, Parent - nil и для комментария первого уровня.
+type CommentTarget struct {
+	Post   *model.Post
+	Sender *model.User
+	Parent *model.Comment
+}
+
+// CommentCheck проверяет правила создания комментария, ошибка отменяет вставку.
+type CommentCheck func(target CommentTarget) error
+
+type UserRepository interface {
+	Users(ctx context.Context, first *int, after *string) (*model.UserConnection, error)
+	UserByID(ctx context.Context, id string) (*model.User, error)
+	// UsersByIDs отдает найденных пользователей по id, отсутствующих в ответе нет
+	UsersByIDs(ctx context.Context, ids []string) (map[string]*model.User, error)
+	UserByUsername(ctx context.Context, username string) (*model.User, error)
+	CreateUser(ctx context.Context, input model.NewUser) (*model.User, error)
+}
+
+type VoteRepository interface {
+	// Vote выставляет голос пользователя, value 0 отзывает голос
+	Vote(ctx context.Context, targetType model.VoteTarget, targetID, userID string, value int) (*model.VoteResult, error)
+	MyVote(ctx context.Context, targetType model.VoteTarget, targetID, userID string) (int, error)
+}
+
+type SearchRepository interface {
+	// Search ищет посты и комментарии по словам запроса и отдает их от более релевантных к менее
+	Search(ctx context.Context, query string, searchType model.SearchType, createdAt *model.DateRange, first *int, after *string) (*model.SearchConnection, error)
+}
+
+// CommentEvents доставляет события обсуждения (новые комментарии, открытие и закрытие комментариев)
+// в handler, пока не отменен ctx.
+type CommentEvents interface {
+	Listen(ctx context.Context, handler func(postID string, event model.CommentThreadEvent)) error
 }
 
 type Repository struct {
 	PostRepository
 	CommentRepository
+	UserRepository
+	VoteRepository
+	SearchRepository
+	CommentEvents
 }
 
-func NewPostgresRepository(db *sqlx.DB) *Repository {
+func NewPostgresRepository(db *sqlx.DB, listener *pq.Listener) *Repository {
+	comments := NewPostgresCommentRepo(db)
+
 	return &Repository{
 		PostRepository:    NewPostgresPostRepo(db),
-		CommentRepository: NewPostgresCommentRepo(db),
+		CommentRepository: comments,
+		UserRepository:    NewPostgresUserRepo(db),
+		VoteRepository:    NewPostgresVoteRepo(db),
+		SearchRepository:  NewPostgresSearchRepo(db),
+		CommentEvents:     NewPostgresCommentEvents(listener, comments),
 	}
 }
 
 func NewMemoryRepository(storage *memory.Storage) *Repository {
+	events := NewMemoryCommentEvents()
+
 	return &Repository{
-		PostRepository:    NewMemoryPostRepo(storage),
-		CommentRepository: NewMemoryCommentRepo(storage),
+		PostRepository:    NewMemoryPostRepo(storage, events),
+		CommentRepository: NewMemoryCommentRepo(storage, events),
+		UserRepository:    NewMemoryUserRepo(storage),
+		VoteRepository:    NewMemoryVoteRepo(storage),
+		SearchRepository:  NewMemorySearchRepo(storage),
+		CommentEvents:     events,
 	}
 }
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"html"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/pkg/cursor"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Вид документа в выдаче поиска. При равном рейтинге и времени создания комментарии идут раньше постов.
+const (
+	searchKindPost    = 1
+	searchKindComment = 2
+)
+
+// searchPosition - позиция документа в выдаче: (rank, createdAt, kind, id) по убыванию.
+type searchPosition struct {
+	Rank      float64
+	CreatedAt time.Time
+	Kind      int
+	ID        string
+}
+
+func searchTypeKinds(searchType model.SearchType) ([]int, error) {
+	switch searchType {
+	case "", model.SearchTypeAll:
+		return []int{searchKindPost, searchKindComment}, nil
+	case model.SearchTypePosts:
+		return []int{searchKindPost}, nil
+	case model.SearchTypeComments:
+		return []int{searchKindComment}, nil
+	}
+	return nil, ErrUnknownSearch
+}
+
+// searchCursorID кодирует вид документа в id курсора: у постов и комментариев общие id.
+func searchCursorID(kind int, id string) string {
+	if kind == searchKindComment {
+		return "comment:" + id
+	}
+	return "post:" + id
+}
+
+func decodeSearchCursor(c *cursor.Cursor) (searchPosition, error) {
+	rank, err := strconv.ParseFloat(c.Rank, 64)
+	if err != nil {
+		return searchPosition{}, ErrInvalidCursor
+	}
+
+	//id числовые в обоих хранилищах, в базе они сравниваются с целочисленной колонкой
+	kindName, id, ok := strings.Cut(c.ID, ":")
+	if !ok {
+		return searchPosition{}, ErrInvalidCursor
+	}
+	if _, err := strconv.Atoi(id); err != nil {
+		return searchPosition{}, ErrInvalidCursor
+	}
+
+	createdAt, err := cursorTime(c)
+	if err != nil {
+		return searchPosition{}, err
+	}
+
+	position := searchPosition{Rank: rank, CreatedAt: createdAt, ID: id}
+	switch kindName {
+	case "post":
+		position.Kind = searchKindPost
+	case "comment":
+		position.Kind = searchKindComment
+	default:
+		return searchPosition{}, ErrInvalidCursor
+	}
+
+	return position, nil
+}
+
+// compareSearch возвращает отрицательное число, если a идет в выдаче раньше b.
+func compareSearch(a, b searchPosition) int {
+	if a.Rank != b.Rank {
+		if a.Rank > b.Rank {
+			return -1
+		}
+		return 1
+	}
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return -c
+	}
+	if a.Kind != b.Kind {
+		return b.Kind - a.Kind
+	}
+	return -cursor.CompareID(a.ID, b.ID)
+}
+
+// Маркеры совпадений в ts_headline. Текст сниппета экранируется целиком, и только потом маркеры
+// заменяются тегами, чтобы разметка из текста поста не попала клиенту как HTML.
+const (
+	snippetStartSel = "\x02"
+	snippetStopSel  = "\x03"
+)
+
+var snippetTags = strings.NewReplacer(snippetStartSel, "<b>", snippetStopSel, "</b>")
+
+// renderSnippet экранирует сниппет с маркерами совпадений и заменяет маркеры тегами <b></b>.
+func renderSnippet(marked string) string {
+	return snippetTags.Replace(html.EscapeString(marked))
+}
+
+// newSearchConnection ожидает на вход до size+1 документов вместе с их позициями.
+func newSearchConnection(hits []*model.SearchHit, positions []searchPosition, size int) *model.SearchConnection {
+	hasNextPage := len(hits) > size
+	if hasNextPage {
+		hits = hits[:size]
+	}
+
+	connection := &model.SearchConnection{
+		Edges:    make([]*model.SearchEdge, 0, len(hits)),
+		PageInfo: &model.PageInfo{HasNextPage: hasNextPage},
+	}
+
+	for i, hit := range hits {
+		p := positions[i]
+		connection.Edges = append(connection.Edges, &model.SearchEdge{
+			Cursor: cursor.EncodeRanked(strconv.FormatFloat(p.Rank, 'g', -1, 64), model.FormatTimestamp(p.CreatedAt), searchCursorID(p.Kind, p.ID)),
+			Node:   hit,
+		})
+	}
+
+	if len(connection.Edges) > 0 {
+		endCursor := connection.Edges[len(connection.Edges)-1].Cursor
+		connection.PageInfo.EndCursor = &endCursor
+	}
+
+	return connection
+}
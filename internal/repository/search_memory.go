@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/pkg/memory"
+	"sort"
+	"strings"
+)
+
+// snippetWords - длина сниппета в словах, как MaxWords у ts_headline по умолчанию.
+const snippetWords = 35
+
+type MemorySearchRepository struct {
+	Storage *memory.Storage
+}
+
+func NewMemorySearchRepo(storage *memory.Storage) *MemorySearchRepository {
+	return &MemorySearchRepository{
+		Storage: storage,
+	}
+}
+
+func (r *MemorySearchRepository) Search(ctx context.Context, query string, searchType model.SearchType, createdAt *model.DateRange, first *int, after *string) (*model.SearchConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := searchTypeKinds(searchType)
+	if err != nil {
+		return nil, err
+	}
+
+	var start *searchPosition
+	if c != nil {
+		position, err := decodeSearchCursor(c)
+		if err != nil {
+			return nil, err
+		}
+		start = &position
+	}
+
+	var hits []*model.SearchHit
+	var positions []searchPosition
+	err = r.Storage.View(func(tx *memory.Tx) error {
+		hits, positions = r.match(tx, query, kinds, createdAt, start)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(hits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return compareSearch(positions[order[i]], positions[order[j]]) < 0
+	})
+
+	if len(order) > size+1 {
+		order = order[:size+1]
+	}
+
+	pageHits := make([]*model.SearchHit, 0, len(order))
+	pagePositions := make([]searchPosition, 0, len(order))
+	for _, i := range order {
+		pageHits = append(pageHits, hits[i])
+		pagePositions = append(pagePositions, positions[i])
+	}
+
+	return newSearchConnection(pageHits, pagePositions, size), nil
+}
+
+// match собирает найденные записи после курсора start вместе с их позициями в выдаче.
+func (r *MemorySearchRepository) match(tx *memory.Tx, query string, kinds []int, createdAt *model.DateRange, start *searchPosition) ([]*model.SearchHit, []searchPosition) {
+	var hits []*model.SearchHit
+	var positions []searchPosition
+
+	for key, rank := range tx.Search(query) {
+		kindName, id, _ := strings.Cut(key, ":")
+
+		var hit *model.SearchHit
+		var position searchPosition
+
+		switch {
+		case kindName == "post" && hasKind(kinds, searchKindPost):
+			post, ok := tx.Posts[id]
+			if !ok {
+				continue
+			}
+			hit = &model.SearchHit{Node: memory.CopyPost(post), Rank: rank, Snippet: highlight(post.Title+" "+post.Text, query)}
+			position = searchPosition{Rank: rank, CreatedAt: post.CreatedAt, Kind: searchKindPost, ID: id}
+		case kindName == "comment" && hasKind(kinds, searchKindComment):
+			comment, ok := tx.Comments[id]
+			if !ok {
+				continue
+			}
+			hit = &model.SearchHit{Node: memory.CopyComment(comment), Rank: rank, Snippet: highlight(comment.Text, query)}
+			position = searchPosition{Rank: rank, CreatedAt: comment.CreatedAt, Kind: searchKindComment, ID: id}
+		default:
+			continue
+		}
+
+		if !inDateRange(createdAt, position.CreatedAt) {
+			continue
+		}
+		if start != nil && compareSearch(position, *start) <= 0 {
+			continue
+		}
+
+		hits = append(hits, hit)
+		positions = append(positions, position)
+	}
+
+	return hits, positions
+}
+
+func hasKind(kinds []int, kind int) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight повторяет ts_headline: выделяет найденные слова тегами <b></b>, экранируя остальной текст,
+// и обрезает текст до snippetWords слов вокруг первого совпадения.
+func highlight(text, query string) string {
+	terms := make(map[string]struct{})
+	for _, term := range memory.Tokenize(query) {
+		terms[term] = struct{}{}
+	}
+
+	words := strings.Fields(text)
+	matched := make([]bool, len(words))
+	firstMatch := -1
+	for i, word := range words {
+		for _, term := range memory.Tokenize(word) {
+			if _, ok := terms[term]; ok {
+				matched[i] = true
+				break
+			}
+		}
+		if matched[i] && firstMatch < 0 {
+			firstMatch = i
+		}
+	}
+
+	from := 0
+	if firstMatch > snippetWords/4 {
+		from = firstMatch - snippetWords/4
+	}
+	to := from + snippetWords
+	if to > len(words) {
+		to = len(words)
+	}
+
+	snippet := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		if matched[i] {
+			snippet = append(snippet, snippetStartSel+words[i]+snippetStopSel)
+			continue
+		}
+		snippet = append(snippet, words[i])
+	}
+
+	return renderSnippet(strings.Join(snippet, " "))
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"ozon-graphql-api/graph/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PostgresSearchRepository struct {
+	Db *sqlx.DB
+}
+
+func NewPostgresSearchRepo(db *sqlx.DB) *PostgresSearchRepository {
+	return &PostgresSearchRepository{
+		Db: db,
+	}
+}
+
+// dbSearchStruct - строка общей выдачи постов и комментариев, поля другого вида документа равны NULL.
+type dbSearchStruct struct {
+	Kind                  int        `db:"kind"`
+	ID                    int        `db:"id"`
+	Rank                  float64    `db:"rank"`
+	Snippet               string     `db:"snippet"`
+	Body                  string     `db:"body"`
+	CreatedAt             time.Time  `db:"createdat"`
+	Title                 *string    `db:"title"`
+	Text                  string     `db:"text"`
+	IsCommentingAvailable *bool      `db:"iscommentingavailable"`
+	PostID                *int       `db:"postid"`
+	ReplyTo               *int       `db:"replyto"`
+	UserID                *int       `db:"userid"`
+	Username              *string    `db:"username"`
+	EditedAt              *time.Time `db:"editedat"`
+	DeletedAt             *time.Time `db:"deletedat"`
+	Upvotes               int        `db:"upvotes"`
+	Downvotes             int        `db:"downvotes"`
+}
+
+func (r *PostgresSearchRepository) Search(ctx context.Context, query string, searchType model.SearchType, createdAt *model.DateRange, first *int, after *string) (*model.SearchConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := searchTypeKinds(searchType)
+	if err != nil {
+		return nil, err
+	}
+
+	postsQuery := fmt.Sprintf(`SELECT %d AS kind, p.id, ts_rank(p.searchVector, q) AS rank, p.title || ' ' || p.text AS body,
+                                      p.createdAt, p.title, p.text, p.isCommentingAvailable, NULL::integer AS postId, NULL::integer AS replyTo,
+                                      u.id AS userId, u.username, p.editedAt, p.deletedAt, p.upvotes, p.downvotes
+                               FROM %s p JOIN %s u ON p.createdBy = u.id, plainto_tsquery('simple', $1) q
+                               WHERE p.searchVector @@ q AND p.deletedAt IS NULL`,
+		searchKindPost, postsTable, usersTable)
+
+	commentsQuery := fmt.Sprintf(`SELECT %d AS kind, c.id, ts_rank(c.searchVector, q) AS rank, c.text AS body,
+                                         c.createdAt, NULL AS title, c.text, NULL::boolean AS isCommentingAvailable, c.postId, c.replyTo,
+                                         u.id AS userId, u.username, c.editedAt, c.deletedAt, c.upvotes, c.downvotes
+                                  FROM %s c JOIN %s u ON c.sender = u.id, plainto_tsquery('simple', $1) q
+                                  WHERE c.searchVector @@ q AND c.deletedAt IS NULL`,
+		searchKindComment, commentsTable, usersTable)
+
+	var parts []string
+	if hasKind(kinds, searchKindPost) {
+		parts = append(parts, postsQuery)
+	}
+	if hasKind(kinds, searchKindComment) {
+		parts = append(parts, commentsQuery)
+	}
+
+	args := []interface{}{query}
+	conditions, rangeArgs := dateRangeSQL("s.createdAt", len(args)+1, createdAt)
+	args = append(args, rangeArgs...)
+
+	//Keyset-пагинация по (rank, createdAt, kind, id), ts_rank возвращает real
+	if c != nil {
+		position, err := decodeSearchCursor(c)
+		if err != nil {
+			return nil, err
+		}
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf(`(s.rank, s.createdAt, s.kind, s.id) < ($%d::real, $%d, $%d, $%d)`, n+1, n+2, n+3, n+4))
+		args = append(args, c.Rank, position.CreatedAt, position.Kind, position.ID)
+	}
+	args = append(args, size+1)
+
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	//Сниппет считается во внешнем запросе, чтобы ts_headline выполнялся только для строк страницы
+	searchQuery := fmt.Sprintf(`SELECT s.*, ts_headline('simple', s.body, plainto_tsquery('simple', $1),
+                                                  'StartSel=' || chr(2) || ', StopSel=' || chr(3)) AS snippet
+                                FROM (%s) s %s
+                                ORDER BY s.rank DESC, s.createdAt DESC, s.kind DESC, s.id DESC LIMIT $%d`,
+		strings.Join(parts, " UNION ALL "), where, len(args))
+
+	var dbHits []dbSearchStruct
+	if err := r.Db.SelectContext(ctx, &dbHits, searchQuery, args...); err != nil {
+		return nil, err
+	}
+
+	var hits []*model.SearchHit
+	var positions []searchPosition
+
+	for _, row := range dbHits {
+		hits = append(hits, toSearchHit(row))
+		positions = append(positions, searchPosition{
+			Rank:      row.Rank,
+			CreatedAt: row.CreatedAt,
+			Kind:      row.Kind,
+			ID:        strconv.Itoa(row.ID),
+		})
+	}
+
+	return newSearchConnection(hits, positions, size), nil
+}
+
+func toSearchHit(row dbSearchStruct) *model.SearchHit {
+	hit := &model.SearchHit{
+		Rank:    row.Rank,
+		Snippet: renderSnippet(row.Snippet),
+	}
+
+	var author *model.User
+	if row.UserID != nil && row.Username != nil {
+		author = &model.User{
+			ID:       strconv.Itoa(*row.UserID),
+			Username: *row.Username,
+		}
+	}
+
+	if row.Kind == searchKindComment {
+		comment := &model.Comment{
+			ID:        strconv.Itoa(row.ID),
+			Sender:    author,
+			Text:      row.Text,
+			CreatedAt: row.CreatedAt,
+			EditedAt:  row.EditedAt,
+			DeletedAt: row.DeletedAt,
+			Upvotes:   row.Upvotes,
+			Downvotes: row.Downvotes,
+		}
+		if row.PostID != nil {
+			comment.PostID = strconv.Itoa(*row.PostID)
+		}
+		if row.ReplyTo != nil {
+			comment.ReplyTo = &model.Comment{
+				ID: strconv.Itoa(*row.ReplyTo),
+			}
+		}
+		hit.Node = comment
+		return hit
+	}
+
+	post := &model.Post{
+		ID:        strconv.Itoa(row.ID),
+		Text:      row.Text,
+		CreatedBy: author,
+		CreatedAt: row.CreatedAt,
+		EditedAt:  row.EditedAt,
+		DeletedAt: row.DeletedAt,
+		Upvotes:   row.Upvotes,
+		Downvotes: row.Downvotes,
+	}
+	if row.Title != nil {
+		post.Title = *row.Title
+	}
+	if row.IsCommentingAvailable != nil {
+		post.IsCommentingAvailable = *row.IsCommentingAvailable
+	}
+	hit.Node = post
+
+	return hit
+}
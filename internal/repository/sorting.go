@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+	"ozon-graphql-api/pkg/cursor"
+	"ozon-graphql-api/pkg/memory"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sortMode - порядок ленты, общий для постов и комментариев. Значения совпадают с PostSort и CommentSort.
+type sortMode string
+
+const (
+	sortNew           sortMode = "NEW"
+	sortOld           sortMode = "OLD"
+	sortTop           sortMode = "TOP"
+	sortHot           sortMode = "HOT"
+	sortControversial sortMode = "CONTROVERSIAL"
+)
+
+// Параметры hot-рейтинга: каждые hotDecay секунд свежести весят как десятикратный рейтинг.
+// Рейтинг зависит только от голосов и времени создания, поэтому курсор остается валидным со временем.
+const (
+	hotEpoch = 1134028003
+	hotDecay = 45000
+)
+
+func postSortMode(sort model.PostSort) (sortMode, error) {
+	if sort == "" {
+		return sortNew, nil
+	}
+	if !sort.IsValid() {
+		return "", apperr.New(apperr.Validation, fmt.Sprintf("unknown sort %q", sort))
+	}
+	return sortMode(sort), nil
+}
+
+// commentSortMode: пустой sort заменяется на порядок по умолчанию для конкретной ленты.
+func commentSortMode(sort model.CommentSort, fallback sortMode) (sortMode, error) {
+	if sort == "" {
+		return fallback, nil
+	}
+	if !sort.IsValid() {
+		return "", apperr.New(apperr.Validation, fmt.Sprintf("unknown sort %q", sort))
+	}
+	return sortMode(sort), nil
+}
+
+func (s sortMode) ranked() bool {
+	return s == sortTop || s == sortHot || s == sortControversial
+}
+
+// rankSQL возвращает выражение рейтинга для таблицы с псевдонимом alias и его тип.
+// Формулы повторяют rank, иначе порядок в базе и в памяти разойдется.
+func (s sortMode) rankSQL(alias string) (string, string) {
+	score := fmt.Sprintf(`(%[1]s.upvotes - %[1]s.downvotes)`, alias)
+
+	switch s {
+	case sortTop:
+		return score, "integer"
+	case sortHot:
+		return fmt.Sprintf(`(SIGN(%[1]s) * LOG(GREATEST(ABS(%[1]s), 1)::float8) + (EXTRACT(EPOCH FROM %[2]s.createdAt)::float8 - %[3]d) / %[4]d)`,
+			score, alias, hotEpoch, hotDecay), "float8"
+	case sortControversial:
+		return fmt.Sprintf(`(CASE WHEN %[1]s.upvotes > 0 AND %[1]s.downvotes > 0
+                             THEN POWER((%[1]s.upvotes + %[1]s.downvotes)::float8, LEAST(%[1]s.upvotes, %[1]s.downvotes)::float8 / GREATEST(%[1]s.upvotes, %[1]s.downvotes))
+                             ELSE 0 END)`, alias), "float8"
+	}
+	return `0`, "integer"
+}
+
+// orderSQL возвращает ORDER BY для ленты. Рейтинг выбирается в запросе под именем rank.
+func (s sortMode) orderSQL(alias string) string {
+	switch {
+	case s == sortOld:
+		return fmt.Sprintf(`%[1]s.createdAt, %[1]s.id`, alias)
+	case s.ranked():
+		return fmt.Sprintf(`rank DESC, %[1]s.createdAt DESC, %[1]s.id DESC`, alias)
+	}
+	return fmt.Sprintf(`%[1]s.createdAt DESC, %[1]s.id DESC`, alias)
+}
+
+// afterSQL возвращает условие keyset-пагинации, параметры курсора нумеруются с $n.
+func (s sortMode) afterSQL(alias string, n int, c *cursor.Cursor) (string, []interface{}, error) {
+	createdAt, err := cursorTime(c)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := cursorID(c)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case s == sortOld:
+		return fmt.Sprintf(`(%[1]s.createdAt, %[1]s.id) > ($%[2]d, $%[3]d)`, alias, n, n+1),
+			[]interface{}{createdAt, id}, nil
+	case s.ranked():
+		if _, err := s.cursorRank(c); err != nil {
+			return "", nil, err
+		}
+		rank, typ := s.rankSQL(alias)
+		return fmt.Sprintf(`(%[1]s, %[2]s.createdAt, %[2]s.id) < ($%[3]d::%[4]s, $%[5]d, $%[6]d)`, rank, alias, n, typ, n+1, n+2),
+			[]interface{}{c.Rank, createdAt, id}, nil
+	}
+	return fmt.Sprintf(`(%[1]s.createdAt, %[1]s.id) < ($%[2]d, $%[3]d)`, alias, n, n+1),
+		[]interface{}{createdAt, id}, nil
+}
+
+// rank считает рейтинг записи так же, как rankSQL.
+func (s sortMode) rank(createdAt time.Time, upvotes, downvotes int) float64 {
+	score := upvotes - downvotes
+
+	switch s {
+	case sortTop:
+		return float64(score)
+	case sortHot:
+		var sign float64
+		if score > 0 {
+			sign = 1
+		} else if score < 0 {
+			sign = -1
+		}
+		magnitude := math.Abs(float64(score))
+		if magnitude < 1 {
+			magnitude = 1
+		}
+
+		seconds := float64(createdAt.UnixNano()) / 1e9
+
+		return sign*math.Log10(magnitude) + (seconds-hotEpoch)/hotDecay
+	case sortControversial:
+		if upvotes <= 0 || downvotes <= 0 {
+			return 0
+		}
+		balance := float64(min(upvotes, downvotes)) / float64(max(upvotes, downvotes))
+		return math.Pow(float64(upvotes+downvotes), balance)
+	}
+	return 0
+}
+
+// encodeCursor кодирует позицию записи. Для лент по рейтингу в курсор попадает и рейтинг.
+// Рейтинг TOP - целая оценка, и в курсор она пишется без экспоненты: 1e+06 база не приведет к integer.
+func (s sortMode) encodeCursor(rank float64, createdAt time.Time, id string) string {
+	switch {
+	case s == sortTop:
+		return cursor.EncodeRanked(strconv.FormatInt(int64(rank), 10), model.FormatTimestamp(createdAt), id)
+	case s.ranked():
+		return cursor.EncodeRanked(strconv.FormatFloat(rank, 'g', -1, 64), model.FormatTimestamp(createdAt), id)
+	}
+	return cursor.Encode(model.FormatTimestamp(createdAt), id)
+}
+
+// cursorRank разбирает рейтинг из курсора. Рейтинг TOP сравнивается в базе как integer,
+// поэтому дробное значение в его курсоре - испорченный курсор.
+func (s sortMode) cursorRank(c *cursor.Cursor) (float64, error) {
+	if s == sortTop {
+		score, err := strconv.Atoi(c.Rank)
+		if err != nil {
+			return 0, ErrInvalidCursor
+		}
+		return float64(score), nil
+	}
+
+	rank, err := strconv.ParseFloat(c.Rank, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return rank, nil
+}
+
+// sortKey - позиция записи в ленте: рейтинг и пара (createdAt, id) для разрешения равенства.
+type sortKey struct {
+	Rank      float64
+	CreatedAt time.Time
+	ID        string
+}
+
+// compare возвращает отрицательное число, если a идет в ленте раньше b.
+func (s sortMode) compare(a, b sortKey) int {
+	if s.ranked() && a.Rank != b.Rank {
+		if a.Rank > b.Rank {
+			return -1
+		}
+		return 1
+	}
+
+	c := a.CreatedAt.Compare(b.CreatedAt)
+	if c == 0 {
+		c = cursor.CompareID(a.ID, b.ID)
+	}
+	if s == sortOld {
+		return c
+	}
+	return -c
+}
+
+func (s sortMode) cursorKey(c *cursor.Cursor) (sortKey, error) {
+	createdAt, err := cursorTime(c)
+	if err != nil {
+		return sortKey{}, err
+	}
+
+	key := sortKey{CreatedAt: createdAt, ID: c.ID}
+	if !s.ranked() {
+		return key, nil
+	}
+
+	rank, err := s.cursorRank(c)
+	if err != nil {
+		return sortKey{}, err
+	}
+	key.Rank = rank
+
+	return key, nil
+}
+
+// rankedEntry - запись ленты по рейтингу вместе с ее позицией.
+type rankedEntry[T any] struct {
+	key  sortKey
+	item T
+}
+
+// rankedHeap держит лучшие записи страницы, в корне - та, что идет в ленте последней.
+type rankedHeap[T any] struct {
+	mode    sortMode
+	entries []rankedEntry[T]
+}
+
+func (h *rankedHeap[T]) Len() int { return len(h.entries) }
+func (h *rankedHeap[T]) Less(i, j int) bool {
+	return h.mode.compare(h.entries[i].key, h.entries[j].key) > 0
+}
+func (h *rankedHeap[T]) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *rankedHeap[T]) Push(x interface{}) { h.entries = append(h.entries, x.(rankedEntry[T])) }
+func (h *rankedHeap[T]) Pop() interface{} {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// rankedPage отдает до size+1 записей после курсора в ленте по рейтингу вместе с их рейтингами.
+// Рейтинг меняется с каждым голосом, поэтому индекса по нему нет: индекс обходится целиком,
+// а в куче остаются только size+1 лучших записей - O(n log size) вместо сортировки всех n.
+func rankedPage[T any](order *memory.TimeOrder, items map[string]T, match func(T) bool, period *model.DateRange,
+	key func(T) sortKey, mode sortMode, c *cursor.Cursor, size int) ([]T, []float64, error) {
+	var after *sortKey
+	if c != nil {
+		k, err := mode.cursorKey(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = &k
+	}
+
+	limit := size + 1
+	h := &rankedHeap[T]{mode: mode, entries: make([]rankedEntry[T], 0, limit)}
+	order.Ascend(nil, period, func(id string) bool {
+		item, ok := items[id]
+		if !ok || (match != nil && !match(item)) {
+			return true
+		}
+		k := key(item)
+		if after != nil && mode.compare(k, *after) <= 0 {
+			return true
+		}
+		if h.Len() < limit {
+			heap.Push(h, rankedEntry[T]{key: k, item: item})
+		} else if mode.compare(k, h.entries[0].key) < 0 {
+			h.entries[0] = rankedEntry[T]{key: k, item: item}
+			heap.Fix(h, 0)
+		}
+		return true
+	})
+
+	sort.Slice(h.entries, func(i, j int) bool {
+		return mode.compare(h.entries[i].key, h.entries[j].key) < 0
+	})
+
+	page := make([]T, 0, len(h.entries))
+	ranks := make([]float64, 0, len(h.entries))
+	for _, entry := range h.entries {
+		page = append(page, entry.item)
+		ranks = append(ranks, entry.key.Rank)
+	}
+
+	return page, ranks, nil
+}
+
+// orderedPage отдает страницу ленты по хронологическому индексу in-memory хранилища: для NEW и OLD
+// индекс обходится от курсора до size+1 подходящих записей, ленты по рейтингу отдает rankedPage.
+// match nil - подходят все записи.
+func orderedPage[T any](order *memory.TimeOrder, items map[string]T, match func(T) bool, period *model.DateRange,
+	key func(T) sortKey, mode sortMode, c *cursor.Cursor, size int) ([]T, []float64, error) {
+	if mode.ranked() {
+		return rankedPage(order, items, match, period, key, mode, c, size)
+	}
+
+	var after *memory.OrderKey
+	if c != nil {
+		createdAt, err := cursorTime(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = &memory.OrderKey{CreatedAt: createdAt, ID: c.ID}
+	}
+
+	page := make([]T, 0, size+1)
+	visit := func(id string) bool {
+		if item, ok := items[id]; ok && (match == nil || match(item)) {
+			page = append(page, item)
+		}
+		return len(page) <= size
+	}
+
+	if mode == sortOld {
+		order.Ascend(after, period, visit)
+	} else {
+		order.Descend(after, period, visit)
+	}
+
+	return page, nil, nil
+}
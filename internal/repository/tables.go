@@ -4,4 +4,5 @@ const (
 	usersTable    = "users"
 	commentsTable = "comments"
 	postsTable    = "posts"
+	votesTable    = "votes"
 )
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/pkg/cursor"
+	"ozon-graphql-api/pkg/memory"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type MemoryUserRepository struct {
+	Storage *memory.Storage
+}
+
+func NewMemoryUserRepo(storage *memory.Storage) *MemoryUserRepository {
+	return &MemoryUserRepository{
+		Storage: storage,
+	}
+}
+
+func (r *MemoryUserRepository) Users(ctx context.Context, first *int, after *string) (*model.UserConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*model.User
+	err = r.Storage.View(func(tx *memory.Tx) error {
+		for _, user := range tx.Users {
+			if c == nil || cursor.CompareID(user.ID, c.ID) > 0 {
+				users = append(users, user)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//Как и в базе, отдаем пользователей в порядке регистрации
+	sort.Slice(users, func(i, j int) bool {
+		return cursor.CompareID(users[i].ID, users[j].ID) < 0
+	})
+
+	if len(users) > size+1 {
+		users = users[:size+1]
+	}
+
+	return newUserConnection(users, size), nil
+}
+
+func (r *MemoryUserRepository) UsersByIDs(ctx context.Context, ids []string) (map[string]*model.User, error) {
+	users := make(map[string]*model.User, len(ids))
+	err := r.Storage.View(func(tx *memory.Tx) error {
+		for _, id := range ids {
+			if user, ok := tx.Users[id]; ok {
+				users[id] = user
+			}
+		}
+		return nil
+	})
+
+	return users, err
+}
+
+func (r *MemoryUserRepository) UserByID(ctx context.Context, id string) (*model.User, error) {
+	var user *model.User
+	err := r.Storage.View(func(tx *memory.Tx) error {
+		var ok bool
+		if user, ok = tx.Users[id]; !ok {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+
+	return user, err
+}
+
+func (r *MemoryUserRepository) UserByUsername(ctx context.Context, username string) (*model.User, error) {
+	var user *model.User
+	err := r.Storage.View(func(tx *memory.Tx) error {
+		if user = r.findByUsername(tx, username); user == nil {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+
+	return user, err
+}
+
+func (r *MemoryUserRepository) CreateUser(ctx context.Context, input model.NewUser) (*model.User, error) {
+	username := input.Username
+
+	//Проверка уникальности и вставка в одной транзакции, иначе два одинаковых имени могут пройти проверку одновременно
+	var user *model.User
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		if r.findByUsername(tx, username) != nil {
+			return ErrUsernameTaken
+		}
+
+		tx.UserIdCounter++
+		userId := strconv.Itoa(tx.UserIdCounter)
+
+		user = &model.User{
+			ID:       userId,
+			Username: username,
+		}
+		tx.Users[userId] = user
+		tx.Record(memory.UserSaved(user))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// findByUsername сравнивает имена без учета регистра, так же как уникальный индекс в базе.
+// Вызывается внутри транзакции хранилища.
+func (r *MemoryUserRepository) findByUsername(tx *memory.Tx, username string) *model.User {
+	for _, user := range tx.Users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
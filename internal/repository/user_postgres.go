@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"ozon-graphql-api/graph/model"
+	"strconv"
+)
+
+type PostgresUserRepository struct {
+	Db *sqlx.DB
+}
+
+func NewPostgresUserRepo(db *sqlx.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{
+		Db: db,
+	}
+}
+
+func (r *PostgresUserRepository) Users(ctx context.Context, first *int, after *string) (*model.UserConnection, error) {
+	size, c, err := pageArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var where string
+	var args []interface{}
+	if c != nil {
+		id, err := cursorID(c)
+		if err != nil {
+			return nil, err
+		}
+		where = `WHERE id > $1`
+		args = append(args, id)
+	}
+	args = append(args, size+1)
+
+	query := fmt.Sprintf(`SELECT id, username FROM %s %s ORDER BY id LIMIT $%d`, usersTable, where, len(args))
+
+	var dbUsers []dbUserStruct
+	if err := r.Db.SelectContext(ctx, &dbUsers, query, args...); err != nil {
+		return nil, err
+	}
+
+	var users []*model.User
+	for _, u := range dbUsers {
+		users = append(users, &model.User{
+			ID:       strconv.Itoa(u.ID),
+			Username: u.Username,
+		})
+	}
+
+	return newUserConnection(users, size), nil
+}
+
+func (r *PostgresUserRepository) UserByID(ctx context.Context, id string) (*model.User, error) {
+	userId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	query := fmt.Sprintf(`SELECT id, username FROM %s WHERE id = $1`, usersTable)
+	return r.getUser(ctx, query, userId)
+}
+
+func (r *PostgresUserRepository) UsersByIDs(ctx context.Context, ids []string) (map[string]*model.User, error) {
+	query := fmt.Sprintf(`SELECT id, username FROM %s WHERE id = ANY($1)`, usersTable)
+
+	var dbUsers []dbUserStruct
+	if err := r.Db.SelectContext(ctx, &dbUsers, query, pq.Array(batchIDs(ids))); err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]*model.User, len(dbUsers))
+	for _, u := range dbUsers {
+		id := strconv.Itoa(u.ID)
+		users[id] = &model.User{
+			ID:       id,
+			Username: u.Username,
+		}
+	}
+
+	return users, nil
+}
+
+func (r *PostgresUserRepository) UserByUsername(ctx context.Context, username string) (*model.User, error) {
+	query := fmt.Sprintf(`SELECT id, username FROM %s WHERE LOWER(username) = LOWER($1)`, usersTable)
+	return r.getUser(ctx, query, username)
+}
+
+func (r *PostgresUserRepository) CreateUser(ctx context.Context, input model.NewUser) (*model.User, error) {
+	query := fmt.Sprintf(`INSERT INTO %s (username) VALUES ($1) RETURNING id`, usersTable)
+
+	var userId int
+	err := r.Db.QueryRowContext(ctx, query, input.Username).Scan(&userId)
+	if err != nil {
+		//Уникальность имени без учета регистра обеспечивает индекс users_username_lower_idx
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	user := &model.User{
+		ID:       strconv.Itoa(userId),
+		Username: input.Username,
+	}
+
+	return user, nil
+}
+
+func (r *PostgresUserRepository) getUser(ctx context.Context, query string, arg interface{}) (*model.User, error) {
+	var dbUser dbUserStruct
+	if err := r.Db.GetContext(ctx, &dbUser, query, arg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	user := &model.User{
+		ID:       strconv.Itoa(dbUser.ID),
+		Username: dbUser.Username,
+	}
+
+	return user, nil
+}
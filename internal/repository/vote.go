@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"fmt"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+)
+
+func targetNotFound(targetType model.VoteTarget) error {
+	if targetType == model.VoteTargetComment {
+		return ErrCommentNotFound
+	}
+	return ErrPostNotFound
+}
+
+func unknownVoteTarget(targetType model.VoteTarget) error {
+	return apperr.New(apperr.Validation, fmt.Sprintf("unknown vote target %q", targetType))
+}
+
+// voteDeltas считает, на сколько меняются счетчики при замене голоса previous на value.
+func voteDeltas(previous, value int) (upvotes, downvotes int) {
+	if previous == 1 {
+		upvotes--
+	}
+	if previous == -1 {
+		downvotes--
+	}
+	if value == 1 {
+		upvotes++
+	}
+	if value == -1 {
+		downvotes++
+	}
+	return upvotes, downvotes
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/pkg/memory"
+	"strings"
+	"time"
+)
+
+type MemoryVoteRepository struct {
+	Storage *memory.Storage
+}
+
+func NewMemoryVoteRepo(storage *memory.Storage) *MemoryVoteRepository {
+	return &MemoryVoteRepository{
+		Storage: storage,
+	}
+}
+
+func (r *MemoryVoteRepository) Vote(ctx context.Context, targetType model.VoteTarget, targetID, userID string, value int) (*model.VoteResult, error) {
+	//Голос и счетчики меняются в одной транзакции хранилища, как в транзакции базы
+	var result *model.VoteResult
+	err := r.Storage.Update(func(tx *memory.Tx) error {
+		upvotes, downvotes, deletedAt, err := r.counters(tx, targetType, targetID)
+		if err != nil {
+			return err
+		}
+
+		if deletedAt != nil {
+			return ErrVoteForDeleted
+		}
+
+		//В базе голос несуществующего пользователя отклоняет внешний ключ
+		if _, ok := tx.Users[userID]; !ok {
+			return ErrUserNotFound
+		}
+
+		key := voteKey(targetType, targetID)
+		previous := tx.Votes[key][userID]
+
+		if value == 0 {
+			delete(tx.Votes[key], userID)
+			if len(tx.Votes[key]) == 0 {
+				delete(tx.Votes, key)
+			}
+		} else {
+			if tx.Votes[key] == nil {
+				tx.Votes[key] = make(map[string]int)
+			}
+			tx.Votes[key][userID] = value
+		}
+
+		upvotesDelta, downvotesDelta := voteDeltas(previous, value)
+		*upvotes += upvotesDelta
+		*downvotes += downvotesDelta
+
+		tx.Record(memory.VoteSaved(key, userID, value, *upvotes, *downvotes))
+
+		result = &model.VoteResult{
+			TargetType: targetType,
+			TargetID:   targetID,
+			Score:      *upvotes - *downvotes,
+			Upvotes:    *upvotes,
+			Downvotes:  *downvotes,
+			MyVote:     value,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *MemoryVoteRepository) MyVote(ctx context.Context, targetType model.VoteTarget, targetID, userID string) (int, error) {
+	var vote int
+	err := r.Storage.View(func(tx *memory.Tx) error {
+		vote = tx.Votes[voteKey(targetType, targetID)][userID]
+		return nil
+	})
+
+	return vote, err
+}
+
+// counters возвращает указатели на счетчики цели внутри транзакции хранилища.
+func (r *MemoryVoteRepository) counters(tx *memory.Tx, targetType model.VoteTarget, targetID string) (*int, *int, *time.Time, error) {
+	switch targetType {
+	case model.VoteTargetPost:
+		post, ok := tx.Posts[targetID]
+		if !ok {
+			return nil, nil, nil, targetNotFound(targetType)
+		}
+		return &post.Upvotes, &post.Downvotes, post.DeletedAt, nil
+	case model.VoteTargetComment:
+		comment, ok := tx.Comments[targetID]
+		if !ok {
+			return nil, nil, nil, targetNotFound(targetType)
+		}
+		return &comment.Upvotes, &comment.Downvotes, comment.DeletedAt, nil
+	}
+	return nil, nil, nil, unknownVoteTarget(targetType)
+}
+
+func voteKey(targetType model.VoteTarget, targetID string) string {
+	return strings.ToLower(targetType.String()) + ":" + targetID
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"ozon-graphql-api/graph/model"
+	"strconv"
+	"time"
+)
+
+type PostgresVoteRepository struct {
+	Db *sqlx.DB
+}
+
+func NewPostgresVoteRepo(db *sqlx.DB) *PostgresVoteRepository {
+	return &PostgresVoteRepository{
+		Db: db,
+	}
+}
+
+func (r *PostgresVoteRepository) Vote(ctx context.Context, targetType model.VoteTarget, targetID, userID string, value int) (*model.VoteResult, error) {
+	table, column, err := voteTarget(targetType)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(targetID)
+	if err != nil {
+		return nil, targetNotFound(targetType)
+	}
+
+	tx, err := r.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	//Блокировка строки цели упорядочивает голоса за нее, поэтому счетчики не разъезжаются с таблицей голосов
+	var deletedAt *time.Time
+	lockQuery := fmt.Sprintf(`SELECT deletedAt FROM %s WHERE id = $1 FOR UPDATE`, table)
+	if err := tx.QueryRowContext(ctx, lockQuery, id).Scan(&deletedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, targetNotFound(targetType)
+		}
+		return nil, err
+	}
+
+	if deletedAt != nil {
+		return nil, ErrVoteForDeleted
+	}
+
+	//Внешний ключ срабатывает только при записи, а снятие несуществующего голоса ничего не пишет
+	userId, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var userExists bool
+	userQuery := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)`, usersTable)
+	if err := tx.QueryRowContext(ctx, userQuery, userId).Scan(&userExists); err != nil {
+		return nil, err
+	}
+	if !userExists {
+		return nil, ErrUserNotFound
+	}
+
+	var previous int
+	voteQuery := fmt.Sprintf(`SELECT value FROM %s WHERE userId = $1 AND %s = $2`, votesTable, column)
+	if err := tx.QueryRowContext(ctx, voteQuery, userId, id).Scan(&previous); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if value != previous {
+		if err := r.saveVote(ctx, tx, column, id, userId, previous, value); err != nil {
+			return nil, foreignKeyError(err)
+		}
+	}
+
+	upvotesDelta, downvotesDelta := voteDeltas(previous, value)
+
+	result := &model.VoteResult{
+		TargetType: targetType,
+		TargetID:   targetID,
+		MyVote:     value,
+	}
+
+	countersQuery := fmt.Sprintf(`UPDATE %s SET upvotes = upvotes + $2, downvotes = downvotes + $3
+                                      WHERE id = $1 RETURNING upvotes, downvotes`, table)
+	err = tx.QueryRowContext(ctx, countersQuery, id, upvotesDelta, downvotesDelta).Scan(&result.Upvotes, &result.Downvotes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	result.Score = result.Upvotes - result.Downvotes
+
+	return result, nil
+}
+
+func (r *PostgresVoteRepository) MyVote(ctx context.Context, targetType model.VoteTarget, targetID, userID string) (int, error) {
+	_, column, err := voteTarget(targetType)
+	if err != nil {
+		return 0, err
+	}
+
+	//Нечисловой id не найдет ни цели, ни пользователя, как и в in-memory хранилище
+	id, err := strconv.Atoi(targetID)
+	if err != nil {
+		return 0, nil
+	}
+	userId, err := strconv.Atoi(userID)
+	if err != nil {
+		return 0, nil
+	}
+
+	var value int
+	query := fmt.Sprintf(`SELECT value FROM %s WHERE userId = $1 AND %s = $2`, votesTable, column)
+	err = r.Db.QueryRowContext(ctx, query, userId, id).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return value, err
+}
+
+func (r *PostgresVoteRepository) saveVote(ctx context.Context, tx *sqlx.Tx, column string, id, userID, previous, value int) error {
+	var query string
+	var args []interface{}
+
+	switch {
+	case value == 0:
+		query = fmt.Sprintf(`DELETE FROM %s WHERE userId = $1 AND %s = $2`, votesTable, column)
+		args = []interface{}{userID, id}
+	case previous == 0:
+		query = fmt.Sprintf(`INSERT INTO %s (userId, %s, value) VALUES ($1, $2, $3)`, votesTable, column)
+		args = []interface{}{userID, id, value}
+	default:
+		query = fmt.Sprintf(`UPDATE %s SET value = $3 WHERE userId = $1 AND %s = $2`, votesTable, column)
+		args = []interface{}{userID, id, value}
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// voteTarget возвращает таблицу цели и колонку таблицы голосов, которая на нее ссылается.
+func voteTarget(targetType model.VoteTarget) (string, string, error) {
+	switch targetType {
+	case model.VoteTargetPost:
+		return postsTable, "postId", nil
+	case model.VoteTargetComment:
+		return commentsTable, "commentId", nil
+	}
+	return "", "", unknownVoteTarget(targetType)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+)
+
+// ErrReplyToOtherPost - ответ на комментарий из другого поста разорвал бы дерево обсуждения.
+var ErrReplyToOtherPost = apperr.Invalid([]apperr.FieldError{{
+	Field:   "replyTo",
+	Rule:    "same_post",
+	Message: "should be a comment of the same post",
+}})
+
+// CommentService проверяет ввод и правила создания комментариев одинаково для обоих хранилищ.
+// Правила выполняются внутри транзакции вставки репозитория, поэтому пост не закроется и родитель
+// не пропадет между проверкой и записью.
+type CommentService struct {
+	comments  repository.CommentRepository
+	validator *validation.Validator
+}
+
+func NewCommentService(repos *repository.Repository, validator *validation.Validator) *CommentService {
+	return &CommentService{
+		comments:  repos.CommentRepository,
+		validator: validator,
+	}
+}
+
+// CreateComment создает комментарий от имени input.SenderID. Пост должен существовать и быть открыт
+// для комментариев, отправитель - существовать, а родительский комментарий - относиться к тому же посту.
+func (s *CommentService) CreateComment(ctx context.Context, input model.NewComment) (*model.Comment, error) {
+	if err := s.validator.NewComment(input); err != nil {
+		return nil, err
+	}
+
+	return s.comments.CreateComment(ctx, input, func(target repository.CommentTarget) error {
+		return checkNewComment(input, target)
+	})
+}
+
+func (s *CommentService) UpdateComment(ctx context.Context, id, userID, text string) (*model.Comment, error) {
+	if err := s.validator.UpdateComment(text); err != nil {
+		return nil, err
+	}
+
+	return s.comments.UpdateComment(ctx, id, userID, text)
+}
+
+func (s *CommentService) DeleteComment(ctx context.Context, id, userID string) error {
+	return s.comments.DeleteComment(ctx, id, userID)
+}
+
+func checkNewComment(input model.NewComment, target repository.CommentTarget) error {
+	if target.Post == nil {
+		return repository.ErrPostNotFound
+	}
+	if !target.Post.IsCommentingAvailable || target.Post.DeletedAt != nil {
+		return repository.ErrCommentingClosed
+	}
+
+	if target.Sender == nil {
+		return repository.ErrUserNotFound
+	}
+
+	if input.ReplyTo == nil {
+		return nil
+	}
+	if target.Parent == nil {
+		return repository.ErrReplyToNotFound
+	}
+	if target.Parent.PostID != target.Post.ID {
+		return ErrReplyToOtherPost
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+)
+
+// PostService проверяет ввод и правила изменения постов одинаково для обоих хранилищ.
+// Авторство и удаление проверяет репозиторий: там проверка выполняется атомарно с записью.
+type PostService struct {
+	posts     repository.PostRepository
+	users     repository.UserRepository
+	validator *validation.Validator
+}
+
+func NewPostService(repos *repository.Repository, validator *validation.Validator) *PostService {
+	return &PostService{
+		posts:     repos.PostRepository,
+		users:     repos.UserRepository,
+		validator: validator,
+	}
+}
+
+// CreatePost создает пост от имени input.UserID. Автор должен существовать.
+func (s *PostService) CreatePost(ctx context.Context, input model.NewPost) (*model.Post, error) {
+	if err := s.validator.NewPost(&input); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.users.UserByID(ctx, input.UserID); err != nil {
+		return nil, err
+	}
+
+	return s.posts.CreatePost(ctx, input)
+}
+
+func (s *PostService) UpdatePost(ctx context.Context, id, userID string, input model.UpdatePost) (*model.Post, error) {
+	if err := s.validator.UpdatePost(input); err != nil {
+		return nil, err
+	}
+
+	return s.posts.UpdatePost(ctx, id, userID, input)
+}
+
+func (s *PostService) DeletePost(ctx context.Context, id, userID string) error {
+	return s.posts.DeletePost(ctx, id, userID)
+}
+
+func (s *PostService) SetCommentingAvailable(ctx context.Context, id, userID string, available bool) (*model.Post, error) {
+	return s.posts.SetCommentingAvailable(ctx, id, userID, available)
+}
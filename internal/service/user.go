@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+)
+
+// UserService проверяет ввод при регистрации пользователя. Уникальность имени проверяет
+// репозиторий: в базе ее обеспечивает индекс, в памяти - транзакция хранилища.
+type UserService struct {
+	users     repository.UserRepository
+	validator *validation.Validator
+}
+
+func NewUserService(repos *repository.Repository, validator *validation.Validator) *UserService {
+	return &UserService{
+		users:     repos.UserRepository,
+		validator: validator,
+	}
+}
+
+func (s *UserService) CreateUser(ctx context.Context, input model.NewUser) (*model.User, error) {
+	if err := s.validator.NewUser(&input); err != nil {
+		return nil, err
+	}
+
+	return s.users.CreateUser(ctx, input)
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+)
+
+// VoteService проверяет значение голоса одинаково для обоих хранилищ.
+type VoteService struct {
+	votes     repository.VoteRepository
+	validator *validation.Validator
+}
+
+func NewVoteService(repos *repository.Repository, validator *validation.Validator) *VoteService {
+	return &VoteService{
+		votes:     repos.VoteRepository,
+		validator: validator,
+	}
+}
+
+func (s *VoteService) Vote(ctx context.Context, targetType model.VoteTarget, targetID, userID string, value int) (*model.VoteResult, error) {
+	if err := s.validator.Vote(value); err != nil {
+		return nil, err
+	}
+
+	return s.votes.Vote(ctx, targetType, targetID, userID, value)
+}
@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"fmt"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+	"strings"
+	"unicode/utf8"
+)
+
+// Правила, которые попадают в extensions.fields[].rule.
+const (
+	RuleRequired  = "required"
+	RuleMaxLength = "max_length"
+	RuleDateRange = "date_range"
+	RuleOneOf     = "one_of"
+)
+
+// Ограничения по умолчанию. Заголовок и имя пользователя хранятся в VARCHAR(255),
+// поэтому поднимать их лимиты выше 255 без миграции нельзя.
+const (
+	DefaultMaxTitleLength    = 255
+	DefaultMaxPostLength     = 10000
+	DefaultMaxCommentLength  = 2000
+	DefaultMaxUsernameLength = 255
+)
+
+// Config - ограничения длины в символах, 0 - значение по умолчанию.
+type Config struct {
+	MaxTitleLength    int
+	MaxPostLength     int
+	MaxCommentLength  int
+	MaxUsernameLength int
+}
+
+// Validator проверяет ввод мутаций до обращения к хранилищу, поэтому правила одинаковы
+// для обоих хранилищ. Ошибка перечисляет все нарушенные правила, а не только первое.
+type Validator struct {
+	cfg Config
+}
+
+func New(cfg Config) *Validator {
+	if cfg.MaxTitleLength <= 0 {
+		cfg.MaxTitleLength = DefaultMaxTitleLength
+	}
+	if cfg.MaxPostLength <= 0 {
+		cfg.MaxPostLength = DefaultMaxPostLength
+	}
+	if cfg.MaxCommentLength <= 0 {
+		cfg.MaxCommentLength = DefaultMaxCommentLength
+	}
+	if cfg.MaxUsernameLength <= 0 {
+		cfg.MaxUsernameLength = DefaultMaxUsernameLength
+	}
+	return &Validator{cfg: cfg}
+}
+
+// NewUser также убирает пробелы по краям имени: имя хранится без них.
+func (v *Validator) NewUser(input *model.NewUser) error {
+	input.Username = strings.TrimSpace(input.Username)
+
+	var errs fieldErrors
+	errs.text("username", input.Username, v.cfg.MaxUsernameLength)
+	return errs.err()
+}
+
+// NewPost также подставляет значения по умолчанию: без isCommentingAvailable комментарии открыты.
+func (v *Validator) NewPost(input *model.NewPost) error {
+	if input.IsCommentingAvailable == nil {
+		available := true
+		input.IsCommentingAvailable = &available
+	}
+
+	var errs fieldErrors
+	errs.text("title", input.Title, v.cfg.MaxTitleLength)
+	errs.text("text", input.Text, v.cfg.MaxPostLength)
+	return errs.err()
+}
+
+// UpdatePost проверяет только переданные поля.
+func (v *Validator) UpdatePost(input model.UpdatePost) error {
+	var errs fieldErrors
+	if input.Title != nil {
+		errs.text("title", *input.Title, v.cfg.MaxTitleLength)
+	}
+	if input.Text != nil {
+		errs.text("text", *input.Text, v.cfg.MaxPostLength)
+	}
+	return errs.err()
+}
+
+func (v *Validator) NewComment(input model.NewComment) error {
+	var errs fieldErrors
+	errs.required("postID", input.PostID)
+	if input.ReplyTo != nil {
+		errs.required("replyTo", *input.ReplyTo)
+	}
+	errs.text("text", input.Text, v.cfg.MaxCommentLength)
+	return errs.err()
+}
+
+func (v *Validator) UpdateComment(text string) error {
+	var errs fieldErrors
+	errs.text("text", text, v.cfg.MaxCommentLength)
+	return errs.err()
+}
+
+// Vote проверяет значение голоса: -1 против, 1 за, 0 снимает голос.
+func (v *Validator) Vote(value int) error {
+	var errs fieldErrors
+	if value < -1 || value > 1 {
+		errs.add("value", RuleOneOf, "should be -1, 0 or 1")
+	}
+	return errs.err()
+}
+
+// DateRange проверяет фильтр по времени создания: from должен быть раньше to.
+func (v *Validator) DateRange(field string, period *model.DateRange) error {
+	var errs fieldErrors
+	if period != nil && period.From != nil && period.To != nil && !period.From.Before(*period.To) {
+		errs.add(field, RuleDateRange, "from should be earlier than to")
+	}
+	return errs.err()
+}
+
+type fieldErrors []apperr.FieldError
+
+func (e *fieldErrors) add(field, rule, message string) {
+	*e = append(*e, apperr.FieldError{Field: field, Rule: rule, Message: message})
+}
+
+// required считает пустыми и строки из одних пробелов.
+func (e *fieldErrors) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		e.add(field, RuleRequired, "should not be empty")
+		return false
+	}
+	return true
+}
+
+// text проверяет обязательное текстовое поле. Длина считается в символах, а не в байтах.
+func (e *fieldErrors) text(field, value string, maxLength int) {
+	if !e.required(field, value) {
+		return
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		e.add(field, RuleMaxLength, fmt.Sprintf("should not exceed %d characters", maxLength))
+	}
+}
+
+func (e fieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return apperr.Invalid(e)
+}
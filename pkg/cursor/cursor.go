@@ -0,0 +1,78 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const separator = "|"
+
+// Cursor указывает на позицию элемента в ленте: пара (createdAt, id) однозначно
+// задаёт место записи и не сдвигается, когда в ленту добавляются новые записи.
+// Для списков, упорядоченных только по id, CreatedAt пустой.
+// Для лент, упорядоченных по рейтингу, в Rank хранится значение рейтинга записи.
+type Cursor struct {
+	Rank      string
+	CreatedAt string
+	ID        string
+}
+
+func Encode(createdAt, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt + separator + id))
+}
+
+func EncodeRanked(rank, createdAt, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(rank + separator + createdAt + separator + id))
+}
+
+func Decode(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	// Ни одна из частей не содержит разделителя
+	parts := strings.Split(string(data), separator)
+	if parts[len(parts)-1] == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	switch len(parts) {
+	case 2:
+		return Cursor{CreatedAt: parts[0], ID: parts[1]}, nil
+	case 3:
+		if parts[0] == "" {
+			return Cursor{}, ErrInvalidCursor
+		}
+		return Cursor{Rank: parts[0], CreatedAt: parts[1], ID: parts[2]}, nil
+	}
+
+	return Cursor{}, ErrInvalidCursor
+}
+
+// CompareID сравнивает идентификаторы как числа, если они состоят из цифр,
+// иначе лексикографически.
+func CompareID(a, b string) int {
+	if len(a) != len(b) && isDigits(a) && isDigits(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
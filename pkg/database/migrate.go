@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"log"
+)
+
+// Миграции вшиты в бинарник, поэтому сервис поднимает схему без отдельного контейнера migrate.
+//
+//go:embed schema/*.sql
+var schemaFS embed.FS
+
+// SchemaSource возвращает вшитые миграции в виде источника golang-migrate.
+func SchemaSource() (source.Driver, error) {
+	return iofs.New(schemaFS, "schema")
+}
+
+// Migrate применяет к базе fn, например (*migrate.Migrate).Up. Для миграций открывается отдельное
+// соединение: драйвер закрывает базу вместе с собой. Драйвер postgres берет pg_advisory_lock на время
+// миграции, поэтому реплики, стартующие одновременно, применяют миграции по очереди, а не параллельно.
+func Migrate(cfg Config, fn func(m *migrate.Migrate) error) error {
+	db, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		return err
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	src, err := SchemaSource()
+	if err != nil {
+		driver.Close()
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, cfg.DBName, driver)
+	if err != nil {
+		src.Close()
+		driver.Close()
+		return err
+	}
+	defer m.Close()
+
+	return fn(m)
+}
+
+// MigrateUp применяет все новые миграции. Схема, которая уже в актуальной версии, - не ошибка.
+func MigrateUp(cfg Config) error {
+	return Migrate(cfg, func(m *migrate.Migrate) error {
+		err := m.Up()
+		if errors.Is(err, migrate.ErrNoChange) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		version, _, err := m.Version()
+		if err != nil {
+			return err
+		}
+		log.Printf("database schema migrated to version %d", version)
+		return nil
+	})
+}
@@ -3,6 +3,9 @@ package database
 import (
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"log"
+	"time"
 )
 
 type Config struct {
@@ -12,20 +15,54 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+	//Применять вшитые миграции при подключении
+	AutoMigrate bool
+	//Пул соединений, 0 - значение database/sql по умолчанию
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func (cfg Config) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.Username, cfg.DBName, cfg.Password, cfg.SSLMode)
 }
 
 func NewPostgresDB(cfg Config) (*sqlx.DB, error) {
-	db, err := sqlx.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.Username, cfg.DBName, cfg.Password, cfg.SSLMode))
+	db, err := sqlx.Open("postgres", cfg.DSN())
 
 	if err != nil {
 		return nil, err
 	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	err = db.Ping()
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.AutoMigrate {
+		if err := MigrateUp(cfg); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrate database: %w", err)
+		}
+	}
+
 	return db, nil
 }
+
+// NewListener открывает отдельное соединение для LISTEN/NOTIFY,
+// которое само переподключается при обрыве.
+func NewListener(cfg Config) *pq.Listener {
+	return pq.NewListener(cfg.DSN(), 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("postgres listener: %v", err)
+		}
+	})
+}
@@ -0,0 +1,4 @@
+-- Пользователи из первой миграции вставлены с явными id, сдвигаем последовательность за них
+SELECT setval('users_id_seq', (SELECT MAX(id) FROM users));
+
+CREATE UNIQUE INDEX users_username_lower_idx ON users (LOWER(username));
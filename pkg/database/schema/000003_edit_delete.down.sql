@@ -0,0 +1,5 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS deletedAt;
+ALTER TABLE comments DROP COLUMN IF EXISTS editedAt;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS deletedAt;
+ALTER TABLE posts DROP COLUMN IF EXISTS editedAt;
@@ -0,0 +1,5 @@
+ALTER TABLE posts ADD COLUMN editedAt TIMESTAMPTZ;
+ALTER TABLE posts ADD COLUMN deletedAt TIMESTAMPTZ;
+
+ALTER TABLE comments ADD COLUMN editedAt TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN deletedAt TIMESTAMPTZ;
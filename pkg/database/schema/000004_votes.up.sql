@@ -0,0 +1,18 @@
+-- Голос ссылается ровно на один пост или комментарий и удаляется вместе с ним
+CREATE TABLE votes (
+    userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    postId INTEGER REFERENCES posts(id) ON DELETE CASCADE,
+    commentId INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    CHECK ((postId IS NULL) <> (commentId IS NULL))
+);
+
+CREATE UNIQUE INDEX votes_user_post_idx ON votes (userId, postId) WHERE postId IS NOT NULL;
+CREATE UNIQUE INDEX votes_user_comment_idx ON votes (userId, commentId) WHERE commentId IS NOT NULL;
+
+-- Денормализованные счетчики обновляются в той же транзакции, что и голос
+ALTER TABLE posts ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE comments ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;
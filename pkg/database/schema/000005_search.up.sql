@@ -0,0 +1,12 @@
+-- Конфигурация simple не использует стемминг: так поиск одинаково работает для русских и английских текстов
+-- и совпадает с инвертированным индексом in-memory хранилища
+ALTER TABLE posts ADD COLUMN searchVector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', text), 'B')
+) STORED;
+
+ALTER TABLE comments ADD COLUMN searchVector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', text), 'B')
+) STORED;
+
+CREATE INDEX posts_search_idx ON posts USING GIN (searchVector);
+CREATE INDEX comments_search_idx ON comments USING GIN (searchVector);
@@ -0,0 +1,101 @@
+package dataloader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWait     = 2 * time.Millisecond
+	DefaultMaxBatch = 100
+)
+
+// FetchFunc загружает значения по набору ключей. Ключей, которых нет в ответе, не существует:
+// Load для них вернет нулевое значение без ошибки.
+type FetchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+type batch[K comparable, V any] struct {
+	keys    []K
+	timer   *time.Timer
+	once    sync.Once
+	done    chan struct{}
+	results map[K]V
+	err     error
+}
+
+// Loader собирает ключи, запрошенные в течение wait, в один вызов fetch и кэширует результат.
+// Кэш живет столько же, сколько Loader, поэтому Loader создается на каждый запрос.
+type Loader[K comparable, V any] struct {
+	fetch    FetchFunc[K, V]
+	wait     time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	cache   map[K]*batch[K, V]
+	current *batch[K, V]
+}
+
+func New[K comparable, V any](fetch FetchFunc[K, V], wait time.Duration, maxBatch int) *Loader[K, V] {
+	if wait <= 0 {
+		wait = DefaultWait
+	}
+	if maxBatch <= 0 {
+		maxBatch = DefaultMaxBatch
+	}
+
+	return &Loader[K, V]{
+		fetch:    fetch,
+		wait:     wait,
+		maxBatch: maxBatch,
+		cache:    make(map[K]*batch[K, V]),
+	}
+}
+
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	b, ok := l.cache[key]
+	if !ok {
+		b = l.current
+		if b == nil {
+			b = &batch[K, V]{done: make(chan struct{})}
+			l.current = b
+			b.timer = time.AfterFunc(l.wait, func() { l.flush(ctx, b) })
+		}
+
+		b.keys = append(b.keys, key)
+		l.cache[key] = b
+
+		//Полный батч отправляем сразу, не дожидаясь таймера. Новые ключи пойдут уже в следующий батч
+		if len(b.keys) >= l.maxBatch {
+			l.current = nil
+			go l.flush(ctx, b)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+
+	return b.results[key], b.err
+}
+
+// flush выполняет батч один раз: второй вызов (от таймера после переполнения) ничего не делает.
+func (l *Loader[K, V]) flush(ctx context.Context, b *batch[K, V]) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.current == b {
+			l.current = nil
+		}
+		keys := b.keys
+		b.timer.Stop()
+		l.mu.Unlock()
+
+		b.results, b.err = l.fetch(ctx, keys)
+		close(b.done)
+	})
+}
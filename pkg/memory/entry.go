@@ -0,0 +1,254 @@
+package memory
+
+import (
+	"fmt"
+	"ozon-graphql-api/graph/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Операции журнала
+const (
+	OpSavePost      = "save_post"
+	OpDeletePost    = "delete_post"
+	OpSaveComment   = "save_comment"
+	OpDeleteComment = "delete_comment"
+	OpSaveUser      = "save_user"
+	OpSaveVote      = "save_vote"
+)
+
+// Entry - запись журнала. Посты и комментарии пишутся без вложенных списков и ссылаются
+// на автора и родителя по id: связи восстанавливаются при воспроизведении.
+type Entry struct {
+	Op      string        `json:"op"`
+	ID      string        `json:"id,omitempty"`
+	Post    *PostEntry    `json:"post,omitempty"`
+	Comment *CommentEntry `json:"comment,omitempty"`
+	User    *model.User   `json:"user,omitempty"`
+	Vote    *VoteEntry    `json:"vote,omitempty"`
+}
+
+type PostEntry struct {
+	ID                    string     `json:"id"`
+	Title                 string     `json:"title"`
+	Text                  string     `json:"text"`
+	CreatedBy             string     `json:"createdBy"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	IsCommentingAvailable bool       `json:"isCommentingAvailable"`
+	EditedAt              *time.Time `json:"editedAt,omitempty"`
+	DeletedAt             *time.Time `json:"deletedAt,omitempty"`
+	Upvotes               int        `json:"upvotes"`
+	Downvotes             int        `json:"downvotes"`
+}
+
+type CommentEntry struct {
+	ID        string     `json:"id"`
+	PostID    string     `json:"postId"`
+	Sender    string     `json:"sender"`
+	ReplyTo   *string    `json:"replyTo,omitempty"`
+	Text      string     `json:"text"`
+	CreatedAt time.Time  `json:"createdAt"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	Upvotes   int        `json:"upvotes"`
+	Downvotes int        `json:"downvotes"`
+}
+
+// VoteEntry хранит голос вместе со счетчиками цели, Value 0 - голос отозван.
+type VoteEntry struct {
+	Key       string `json:"key"`
+	UserID    string `json:"userId"`
+	Value     int    `json:"value"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+}
+
+func PostSaved(post *model.Post) Entry {
+	entry := &PostEntry{
+		ID:                    post.ID,
+		Title:                 post.Title,
+		Text:                  post.Text,
+		CreatedAt:             post.CreatedAt,
+		IsCommentingAvailable: post.IsCommentingAvailable,
+		EditedAt:              post.EditedAt,
+		DeletedAt:             post.DeletedAt,
+		Upvotes:               post.Upvotes,
+		Downvotes:             post.Downvotes,
+	}
+	if post.CreatedBy != nil {
+		entry.CreatedBy = post.CreatedBy.ID
+	}
+	return Entry{Op: OpSavePost, Post: entry}
+}
+
+func PostDeleted(id string) Entry {
+	return Entry{Op: OpDeletePost, ID: id}
+}
+
+func CommentSaved(comment *model.Comment) Entry {
+	entry := &CommentEntry{
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		Text:      comment.Text,
+		CreatedAt: comment.CreatedAt,
+		EditedAt:  comment.EditedAt,
+		DeletedAt: comment.DeletedAt,
+		Upvotes:   comment.Upvotes,
+		Downvotes: comment.Downvotes,
+	}
+	if comment.Sender != nil {
+		entry.Sender = comment.Sender.ID
+	}
+	if comment.ReplyTo != nil {
+		entry.ReplyTo = &comment.ReplyTo.ID
+	}
+	return Entry{Op: OpSaveComment, Comment: entry}
+}
+
+func CommentDeleted(id string) Entry {
+	return Entry{Op: OpDeleteComment, ID: id}
+}
+
+func UserSaved(user *model.User) Entry {
+	return Entry{Op: OpSaveUser, User: &model.User{ID: user.ID, Username: user.Username}}
+}
+
+func VoteSaved(key, userID string, value, upvotes, downvotes int) Entry {
+	return Entry{Op: OpSaveVote, Vote: &VoteEntry{Key: key, UserID: userID, Value: value, Upvotes: upvotes, Downvotes: downvotes}}
+}
+
+// record дописывает изменения в журнал в конце Update: ошибка означает, что изменение
+// не сохранено на диск и подтверждать его клиенту нельзя.
+func (s *Storage) record(entries ...Entry) error {
+	if s.Journal == nil {
+		return nil
+	}
+	return s.Journal.Append(entries...)
+}
+
+// apply повторяет изменение из журнала так же, как его сделал репозиторий.
+func (s *Storage) apply(entry Entry) error {
+	switch entry.Op {
+	case OpSavePost:
+		if entry.Post == nil {
+			return fmt.Errorf("%s without post", entry.Op)
+		}
+		s.applyPost(entry.Post)
+	case OpDeletePost:
+		s.DeletePost(entry.ID)
+	case OpSaveComment:
+		if entry.Comment == nil {
+			return fmt.Errorf("%s without comment", entry.Op)
+		}
+		s.applyComment(entry.Comment)
+	case OpDeleteComment:
+		s.DeleteComment(entry.ID)
+	case OpSaveUser:
+		if entry.User == nil {
+			return fmt.Errorf("%s without user", entry.Op)
+		}
+		s.Users[entry.User.ID] = &model.User{ID: entry.User.ID, Username: entry.User.Username}
+		s.UserIdCounter = maxID(s.UserIdCounter, entry.User.ID)
+	case OpSaveVote:
+		if entry.Vote == nil {
+			return fmt.Errorf("%s without vote", entry.Op)
+		}
+		s.applyVote(entry.Vote)
+	default:
+		return fmt.Errorf("unknown journal operation %q", entry.Op)
+	}
+	return nil
+}
+
+func (s *Storage) applyPost(entry *PostEntry) {
+	post, ok := s.Posts[entry.ID]
+	if !ok {
+		post = &model.Post{ID: entry.ID}
+	}
+
+	post.Title = entry.Title
+	post.Text = entry.Text
+	post.CreatedBy = s.user(entry.CreatedBy)
+	post.CreatedAt = entry.CreatedAt
+	post.IsCommentingAvailable = entry.IsCommentingAvailable
+	post.EditedAt = entry.EditedAt
+	post.DeletedAt = entry.DeletedAt
+	post.Upvotes = entry.Upvotes
+	post.Downvotes = entry.Downvotes
+
+	s.PostIdCounter = maxID(s.PostIdCounter, entry.ID)
+	if ok {
+		s.IndexPost(post)
+	} else {
+		s.PutPost(post)
+	}
+}
+
+func (s *Storage) applyComment(entry *CommentEntry) {
+	//Пост и родитель комментария не меняются, поэтому связи строятся только для нового
+	comment, ok := s.Comments[entry.ID]
+	if !ok {
+		comment = &model.Comment{ID: entry.ID}
+		s.AttachComment(comment, entry.ReplyTo)
+	}
+
+	comment.PostID = entry.PostID
+	comment.Sender = s.user(entry.Sender)
+	comment.Text = entry.Text
+	comment.CreatedAt = entry.CreatedAt
+	comment.EditedAt = entry.EditedAt
+	comment.DeletedAt = entry.DeletedAt
+	comment.Upvotes = entry.Upvotes
+	comment.Downvotes = entry.Downvotes
+
+	s.CommentIdCounter = maxID(s.CommentIdCounter, entry.ID)
+	if ok {
+		s.IndexComment(comment)
+	} else {
+		s.PutComment(comment)
+	}
+}
+
+func (s *Storage) applyVote(entry *VoteEntry) {
+	if entry.Value == 0 {
+		delete(s.Votes[entry.Key], entry.UserID)
+		if len(s.Votes[entry.Key]) == 0 {
+			delete(s.Votes, entry.Key)
+		}
+	} else {
+		if s.Votes[entry.Key] == nil {
+			s.Votes[entry.Key] = make(map[string]int)
+		}
+		s.Votes[entry.Key][entry.UserID] = entry.Value
+	}
+
+	//Ключ голоса - "post:1" или "comment:5", как в поисковом индексе
+	kind, id, _ := strings.Cut(entry.Key, ":")
+	switch kind {
+	case "post":
+		if post, ok := s.Posts[id]; ok {
+			post.Upvotes, post.Downvotes = entry.Upvotes, entry.Downvotes
+		}
+	case "comment":
+		if comment, ok := s.Comments[id]; ok {
+			comment.Upvotes, comment.Downvotes = entry.Upvotes, entry.Downvotes
+		}
+	}
+}
+
+// user возвращает пользователя из хранилища, а для неизвестного id - заглушку, как репозитории.
+func (s *Storage) user(id string) *model.User {
+	if user, ok := s.Users[id]; ok {
+		return user
+	}
+	return &model.User{ID: id}
+}
+
+// maxID не дает счетчику выдать уже занятый id после воспроизведения.
+func maxID(counter int, id string) int {
+	if n, err := strconv.Atoi(id); err == nil && n > counter {
+		return n
+	}
+	return counter
+}
@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+	Журнал - файл, куда каждая мутация дописывает строку JSON с итоговым состоянием измененных записей.
+	Запись делается под блокировкой Storage.Mu до ответа клиенту, поэтому подтвержденные изменения
+	переживают падение процесса. Снимок (SaveToFile) сохраняет все хранилище и очищает журнал,
+	а при запуске LoadFromFile читает снимок и воспроизводит журнал поверх него.
+*/
+
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	//syncInterval 0 - fsync после каждой записи, иначе записи сбрасываются на диск пачкой в фоне
+	syncInterval time.Duration
+	dirty        bool
+	//err - первая ошибка записи на диск, после нее журнал отклоняет новые записи
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenJournal открывает журнал на дозапись. При syncInterval > 0 записи теряются
+// не больше чем за syncInterval до падения, зато мутации не ждут fsync.
+func OpenJournal(filename string, syncInterval time.Duration) (*Journal, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		file:         file,
+		w:            bufio.NewWriter(file),
+		syncInterval: syncInterval,
+	}
+
+	if syncInterval > 0 {
+		j.stop = make(chan struct{})
+		j.done = make(chan struct{})
+		go j.syncLoop()
+	}
+
+	return j, nil
+}
+
+// Append дописывает записи одной операцией, так что они воспроизводятся либо все, либо ни одна.
+func (j *Journal) Append(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.err != nil {
+		return j.err
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if _, err := j.w.Write(data); err != nil {
+		return j.fail(err)
+	}
+
+	if j.syncInterval > 0 {
+		j.dirty = true
+		return nil
+	}
+	return j.sync()
+}
+
+// Err возвращает ошибку записи на диск, после которой журнал отклоняет новые записи, или nil.
+func (j *Journal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.err
+}
+
+// Truncate очищает журнал после того, как его записи попали в снимок.
+func (j *Journal) Truncate() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.err != nil {
+		return j.err
+	}
+
+	if err := j.w.Flush(); err != nil {
+		return j.fail(err)
+	}
+	if err := j.file.Truncate(0); err != nil {
+		return j.fail(err)
+	}
+	j.dirty = false
+	return j.file.Sync()
+}
+
+// Close сбрасывает на диск оставшиеся записи и закрывает файл.
+func (j *Journal) Close() error {
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	err := j.sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (j *Journal) syncLoop() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+
+		j.mu.Lock()
+		if j.dirty && j.err == nil {
+			_ = j.sync()
+		}
+		j.mu.Unlock()
+	}
+}
+
+// sync вызывается под блокировкой j.mu.
+func (j *Journal) sync() error {
+	if j.err != nil {
+		return j.err
+	}
+	if err := j.w.Flush(); err != nil {
+		return j.fail(err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return j.fail(err)
+	}
+	j.dirty = false
+	return nil
+}
+
+// fail запоминает ошибку записи: после нее неизвестно, что попало на диск, и подтверждать
+// новые мутации нельзя.
+func (j *Journal) fail(err error) error {
+	j.err = fmt.Errorf("journal write failed: %w", err)
+	return j.err
+}
+
+// replayJournal применяет записи журнала к хранилищу. Недописанная последняя строка остается
+// от падения во время записи: подтверждения такой операции клиент не получал, и она отрезается.
+func (s *Storage) replayJournal(filename string) error {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				return file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entries []Entry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("journal %s, line %d: %w", filename, line, err)
+		}
+		for _, entry := range entries {
+			if err := s.apply(entry); err != nil {
+				return fmt.Errorf("journal %s, line %d: %w", filename, line, err)
+			}
+		}
+		offset += int64(len(data))
+	}
+}
@@ -0,0 +1,236 @@
+package memory
+
+import (
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/pkg/cursor"
+	"sort"
+	"time"
+)
+
+// OrderKey - позиция записи в хронологическом индексе.
+type OrderKey struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Compare сравнивает позиции по (createdAt, id), как ленты NEW и OLD.
+func (k OrderKey) Compare(other OrderKey) int {
+	if c := k.CreatedAt.Compare(other.CreatedAt); c != 0 {
+		return c
+	}
+	return cursor.CompareID(k.ID, other.ID)
+}
+
+// TimeOrder хранит ключи записей по возрастанию (createdAt, id). Новые записи создаются с текущим
+// временем и почти всегда попадают в конец, поэтому вставка обходится без сдвига.
+// Поиск позиции - O(log n), обход страницы - O(k). Нулевое значение и nil - пустой индекс.
+type TimeOrder struct {
+	keys []OrderKey
+}
+
+func (o *TimeOrder) Len() int {
+	if o == nil {
+		return 0
+	}
+	return len(o.keys)
+}
+
+func (o *TimeOrder) Insert(key OrderKey) {
+	i := o.search(key)
+	if i < len(o.keys) && o.keys[i] == key {
+		return
+	}
+
+	o.keys = append(o.keys, OrderKey{})
+	copy(o.keys[i+1:], o.keys[i:])
+	o.keys[i] = key
+}
+
+func (o *TimeOrder) Remove(key OrderKey) {
+	if o == nil {
+		return
+	}
+
+	i := o.search(key)
+	if i == len(o.keys) || o.keys[i] != key {
+		return
+	}
+	o.keys = append(o.keys[:i], o.keys[i+1:]...)
+}
+
+// Ascend обходит id записей из интервала period по возрастанию, начиная со следующей после after
+// (nil - с начала), пока fn возвращает true.
+func (o *TimeOrder) Ascend(after *OrderKey, period *model.DateRange, fn func(id string) bool) {
+	if o == nil {
+		return
+	}
+
+	lo, hi := o.bounds(period)
+	if after != nil {
+		lo = max(lo, sort.Search(len(o.keys), func(i int) bool { return o.keys[i].Compare(*after) > 0 }))
+	}
+
+	for i := lo; i < hi; i++ {
+		if !fn(o.keys[i].ID) {
+			return
+		}
+	}
+}
+
+// Descend - то же, что Ascend, но по убыванию: after - последняя запись предыдущей страницы ленты NEW.
+func (o *TimeOrder) Descend(after *OrderKey, period *model.DateRange, fn func(id string) bool) {
+	if o == nil {
+		return
+	}
+
+	lo, hi := o.bounds(period)
+	if after != nil {
+		hi = min(hi, o.search(*after))
+	}
+
+	for i := hi - 1; i >= lo; i-- {
+		if !fn(o.keys[i].ID) {
+			return
+		}
+	}
+}
+
+// search возвращает позицию первого ключа, не меньшего key.
+func (o *TimeOrder) search(key OrderKey) int {
+	return sort.Search(len(o.keys), func(i int) bool { return o.keys[i].Compare(key) >= 0 })
+}
+
+// bounds возвращает позиции записей из интервала [From, To).
+func (o *TimeOrder) bounds(period *model.DateRange) (int, int) {
+	lo, hi := 0, len(o.keys)
+	if period == nil {
+		return lo, hi
+	}
+	if period.From != nil {
+		lo = sort.Search(len(o.keys), func(i int) bool { return !o.keys[i].CreatedAt.Before(*period.From) })
+	}
+	if period.To != nil {
+		hi = sort.Search(len(o.keys), func(i int) bool { return !o.keys[i].CreatedAt.Before(*period.To) })
+	}
+	return lo, max(lo, hi)
+}
+
+func postKey(post *model.Post) OrderKey {
+	return OrderKey{CreatedAt: post.CreatedAt, ID: post.ID}
+}
+
+func commentKey(comment *model.Comment) OrderKey {
+	return OrderKey{CreatedAt: comment.CreatedAt, ID: comment.ID}
+}
+
+// PostsByTime - все посты в хронологическом порядке. Вызывается под блокировкой Mu.
+func (s *Storage) PostsByTime() *TimeOrder {
+	return s.postOrder
+}
+
+// CommentsByTime - все комментарии в хронологическом порядке. Вызывается под блокировкой Mu.
+func (s *Storage) CommentsByTime() *TimeOrder {
+	return s.commentOrder
+}
+
+// RootComments - комментарии первого уровня поста. Вызывается под блокировкой Mu.
+func (s *Storage) RootComments(postID string) *TimeOrder {
+	return s.rootComments[postID]
+}
+
+// RepliesTo - прямые ответы на комментарий. Вызывается под блокировкой Mu.
+func (s *Storage) RepliesTo(commentID string) *TimeOrder {
+	return s.replies[commentID]
+}
+
+// PutPost добавляет пост в хранилище, поисковый и хронологический индексы. Время создания
+// поста не меняется, поэтому при изменениях достаточно IndexPost. Вызывается под блокировкой Mu.
+func (s *Storage) PutPost(post *model.Post) {
+	s.RemovePost(post.ID)
+	s.initOrders()
+
+	s.Posts[post.ID] = post
+	s.postOrder.Insert(postKey(post))
+	s.IndexPost(post)
+}
+
+// RemovePost вызывается под блокировкой Mu.
+func (s *Storage) RemovePost(id string) {
+	post, ok := s.Posts[id]
+	if !ok {
+		return
+	}
+
+	delete(s.Posts, id)
+	s.postOrder.Remove(postKey(post))
+	s.UnindexPost(id)
+}
+
+// PutComment добавляет комментарий в хранилище и индексы: общий, комментариев поста первого уровня
+// или ответов родителя. Пост и родитель комментария не меняются. Вызывается под блокировкой Mu.
+func (s *Storage) PutComment(comment *model.Comment) {
+	s.RemoveComment(comment.ID)
+	s.initOrders()
+
+	s.Comments[comment.ID] = comment
+	s.commentOrder.Insert(commentKey(comment))
+	s.parentOrder(comment, true).Insert(commentKey(comment))
+	s.IndexComment(comment)
+}
+
+// RemoveComment вызывается под блокировкой Mu.
+func (s *Storage) RemoveComment(id string) {
+	comment, ok := s.Comments[id]
+	if !ok {
+		return
+	}
+
+	delete(s.Comments, id)
+	s.commentOrder.Remove(commentKey(comment))
+	if order := s.parentOrder(comment, false); order != nil {
+		order.Remove(commentKey(comment))
+		if order.Len() == 0 {
+			s.dropParentOrder(comment)
+		}
+	}
+	s.UnindexComment(id)
+}
+
+// parentOrder возвращает индекс, в котором комментарий стоит среди соседей, при create создает его.
+func (s *Storage) parentOrder(comment *model.Comment, create bool) *TimeOrder {
+	orders, key := s.rootComments, comment.PostID
+	if comment.ReplyTo != nil {
+		orders, key = s.replies, comment.ReplyTo.ID
+	}
+
+	order, ok := orders[key]
+	if !ok && create {
+		order = &TimeOrder{}
+		orders[key] = order
+	}
+	return order
+}
+
+func (s *Storage) dropParentOrder(comment *model.Comment) {
+	if comment.ReplyTo != nil {
+		delete(s.replies, comment.ReplyTo.ID)
+		return
+	}
+	delete(s.rootComments, comment.PostID)
+}
+
+func (s *Storage) initOrders() {
+	s.initMaps()
+	if s.postOrder == nil {
+		s.postOrder = &TimeOrder{}
+	}
+	if s.commentOrder == nil {
+		s.commentOrder = &TimeOrder{}
+	}
+	if s.rootComments == nil {
+		s.rootComments = make(map[string]*TimeOrder)
+	}
+	if s.replies == nil {
+		s.replies = make(map[string]*TimeOrder)
+	}
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"ozon-graphql-api/graph/model"
+	"strings"
+	"unicode"
+)
+
+// Веса полей те же, что у setweight в миграции поиска: заголовок - A, текст - B.
+const (
+	TitleWeight = 1.0
+	TextWeight  = 0.4
+)
+
+// SearchIndex - инвертированный индекс: терм -> ключ документа ("post:1", "comment:5") -> вес терма в документе.
+// Индекс не потокобезопасен, его защищает Storage.Mu.
+type SearchIndex struct {
+	terms map[string]map[string]float64
+	// docs хранит термы документа, чтобы переиндексация не обходила весь индекс
+	docs map[string][]string
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		terms: make(map[string]map[string]float64),
+		docs:  make(map[string][]string),
+	}
+}
+
+// Tokenize разбивает текст на термы: слова из букв и цифр в нижнем регистре.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Add заменяет содержимое документа key в индексе. texts и weights идут парами.
+func (i *SearchIndex) Add(key string, texts []string, weights []float64) {
+	i.Remove(key)
+
+	weightsByTerm := make(map[string]float64)
+	for n, text := range texts {
+		for _, term := range Tokenize(text) {
+			weightsByTerm[term] += weights[n]
+		}
+	}
+
+	terms := make([]string, 0, len(weightsByTerm))
+	for term, weight := range weightsByTerm {
+		docs, ok := i.terms[term]
+		if !ok {
+			docs = make(map[string]float64)
+			i.terms[term] = docs
+		}
+		docs[key] = weight
+		terms = append(terms, term)
+	}
+	i.docs[key] = terms
+}
+
+func (i *SearchIndex) Remove(key string) {
+	for _, term := range i.docs[key] {
+		delete(i.terms[term], key)
+		if len(i.terms[term]) == 0 {
+			delete(i.terms, term)
+		}
+	}
+	delete(i.docs, key)
+}
+
+// Search находит документы, содержащие все термы запроса, и возвращает их рейтинг:
+// сумму весов найденных термов.
+func (i *SearchIndex) Search(query string) map[string]float64 {
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	result := make(map[string]float64)
+	for key, weight := range i.terms[terms[0]] {
+		result[key] = weight
+	}
+
+	for _, term := range terms[1:] {
+		docs := i.terms[term]
+		for key := range result {
+			weight, ok := docs[key]
+			if !ok {
+				delete(result, key)
+				continue
+			}
+			result[key] += weight
+		}
+	}
+
+	return result
+}
+
+func PostKey(id string) string {
+	return "post:" + id
+}
+
+func CommentKey(id string) string {
+	return "comment:" + id
+}
+
+// IndexPost обновляет пост в поисковом индексе, удаленные посты из поиска убираются.
+// Вызывается под блокировкой Storage.Mu.
+func (s *Storage) IndexPost(post *model.Post) {
+	index := s.searchIndex()
+	if post.DeletedAt != nil {
+		index.Remove(PostKey(post.ID))
+		return
+	}
+	index.Add(PostKey(post.ID), []string{post.Title, post.Text}, []float64{TitleWeight, TextWeight})
+}
+
+// IndexComment вызывается под блокировкой Storage.Mu.
+func (s *Storage) IndexComment(comment *model.Comment) {
+	index := s.searchIndex()
+	if comment.DeletedAt != nil {
+		index.Remove(CommentKey(comment.ID))
+		return
+	}
+	index.Add(CommentKey(comment.ID), []string{comment.Text}, []float64{TextWeight})
+}
+
+// UnindexPost вызывается под блокировкой Storage.Mu.
+func (s *Storage) UnindexPost(id string) {
+	s.searchIndex().Remove(PostKey(id))
+}
+
+// UnindexComment вызывается под блокировкой Storage.Mu.
+func (s *Storage) UnindexComment(id string) {
+	s.searchIndex().Remove(CommentKey(id))
+}
+
+// Search вызывается под блокировкой Storage.Mu на чтение.
+func (s *Storage) Search(query string) map[string]float64 {
+	if s.Index == nil {
+		return nil
+	}
+	return s.Index.Search(query)
+}
+
+func (s *Storage) searchIndex() *SearchIndex {
+	if s.Index == nil {
+		s.Index = NewSearchIndex()
+	}
+	return s.Index
+}
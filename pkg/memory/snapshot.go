@@ -0,0 +1,385 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"ozon-graphql-api/graph/model"
+	"path/filepath"
+	"sort"
+)
+
+/*
+	Снимок хранится в конверте {"version": N, "checksum": "sha256:...", "data": {...}}.
+	Контрольная сумма считается по байтам data, поэтому недописанный или испорченный файл
+	не загружается молча. Снимок пишется во временный файл и заменяет старый через rename,
+	так что на диске всегда лежит целый снимок: старый или новый.
+
+	С версии 2 data - плоские списки записей, как в журнале: комментарии ссылаются на родителя,
+	а посты и комментарии на автора по id. Вложенные ответы в JSON превращались бы в копии
+	поддеревьев, поэтому общие указатели строятся заново при загрузке.
+*/
+
+// SnapshotVersion - версия формата, в которой пишет SaveToFile.
+const SnapshotVersion = 2
+
+var ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+
+const checksumPrefix = "sha256:"
+
+type snapshotFile struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// snapshotMigrations[v] переводит данные снимка версии v в версию v+1.
+var snapshotMigrations = map[int]func(data []byte) ([]byte, error){
+	0: migrateSnapshotV0,
+	1: migrateSnapshotV1,
+}
+
+type snapshotData struct {
+	Users            []*model.User             `json:"users"`
+	Posts            []*PostEntry              `json:"posts"`
+	Comments         []*CommentEntry           `json:"comments"`
+	Votes            map[string]map[string]int `json:"votes"`
+	PostIdCounter    int                       `json:"postIdCounter"`
+	CommentIdCounter int                       `json:"commentIdCounter"`
+	UserIdCounter    int                       `json:"userIdCounter"`
+}
+
+// snapshot собирает записи хранилища, отсортированные по id, чтобы одинаковые данные давали одинаковый файл.
+// Вызывается под блокировкой Mu.
+func (s *Storage) snapshot() snapshotData {
+	data := snapshotData{
+		Users:            make([]*model.User, 0, len(s.Users)),
+		Posts:            make([]*PostEntry, 0, len(s.Posts)),
+		Comments:         make([]*CommentEntry, 0, len(s.Comments)),
+		Votes:            s.Votes,
+		PostIdCounter:    s.PostIdCounter,
+		CommentIdCounter: s.CommentIdCounter,
+		UserIdCounter:    s.UserIdCounter,
+	}
+
+	for _, user := range s.Users {
+		data.Users = append(data.Users, &model.User{ID: user.ID, Username: user.Username})
+	}
+	for _, post := range s.Posts {
+		data.Posts = append(data.Posts, PostSaved(post).Post)
+	}
+	for _, comment := range s.Comments {
+		data.Comments = append(data.Comments, CommentSaved(comment).Comment)
+	}
+
+	sort.Slice(data.Users, func(i, j int) bool { return lessID(data.Users[i].ID, data.Users[j].ID) })
+	sort.Slice(data.Posts, func(i, j int) bool { return lessID(data.Posts[i].ID, data.Posts[j].ID) })
+	sort.Slice(data.Comments, func(i, j int) bool { return lessID(data.Comments[i].ID, data.Comments[j].ID) })
+
+	return data
+}
+
+// restoreSnapshot строит хранилище из записей снимка. Комментарии применяются по возрастанию id,
+// поэтому родитель всегда создан раньше ответа и ответ попадает в его Replies.
+func restoreSnapshot(data snapshotData) *Storage {
+	s := &Storage{Index: NewSearchIndex()}
+	s.initOrders()
+
+	for _, user := range data.Users {
+		s.Users[user.ID] = &model.User{ID: user.ID, Username: user.Username}
+	}
+	for _, post := range data.Posts {
+		s.applyPost(post)
+	}
+
+	sort.Slice(data.Comments, func(i, j int) bool { return lessID(data.Comments[i].ID, data.Comments[j].ID) })
+	for _, comment := range data.Comments {
+		s.applyComment(comment)
+	}
+
+	if data.Votes != nil {
+		s.Votes = data.Votes
+	}
+	s.PostIdCounter = data.PostIdCounter
+	s.CommentIdCounter = data.CommentIdCounter
+	s.UserIdCounter = data.UserIdCounter
+
+	return s
+}
+
+// lessID сравнивает числовые id как числа: "9" < "10".
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// SaveToFile сохраняет снимок хранилища и очищает журнал: его записи уже есть в снимке.
+// Мутации пишут в журнал под блокировкой Mu, поэтому между снимком и очисткой записей не появится.
+// keep предыдущих снимков остаются рядом как filename.1 (самый свежий) ... filename.keep.
+// Сохранения выполняются по одному, чтение при этом не блокируется.
+func (s *Storage) SaveToFile(filename string, keep int) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	data, err := json.Marshal(s.snapshot())
+	if err != nil {
+		return err
+	}
+
+	file, err := json.Marshal(snapshotFile{
+		Version:  SnapshotVersion,
+		Checksum: checksum(data),
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := rotateSnapshots(filename, keep); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filename, file); err != nil {
+		return err
+	}
+
+	if s.Journal != nil {
+		return s.Journal.Truncate()
+	}
+	return nil
+}
+
+// LoadFromFile читает снимок и воспроизводит поверх него журнал. Без снимка журнал
+// применяется к пустому хранилищу со стартовыми пользователями. Если снимок есть, но прочитать
+// его нельзя, возвращается ошибка: пустое хранилище при следующем снимке затерло бы данные.
+func LoadFromFile(filename, journal string) (*Storage, error) {
+	s := NewStorage()
+
+	file, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		data, err := readSnapshot(file)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", filename, err)
+		}
+
+		var snapshot snapshotData
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", filename, err)
+		}
+		s = restoreSnapshot(snapshot)
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if err := s.replayJournal(journal); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// readSnapshot проверяет контрольную сумму и приводит данные к текущей версии.
+// Файл без конверта - снимок версии 0, который писали до появления версий.
+func readSnapshot(file []byte) ([]byte, error) {
+	var snapshot snapshotFile
+	if err := json.Unmarshal(file, &snapshot); err != nil {
+		return nil, err
+	}
+
+	if snapshot.Version > SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d is newer than supported %d", snapshot.Version, SnapshotVersion)
+	}
+
+	data := []byte(snapshot.Data)
+	if snapshot.Version == 0 {
+		data = file
+	} else if snapshot.Checksum != checksum(data) {
+		return nil, ErrSnapshotChecksum
+	}
+
+	for version := snapshot.Version; version < SnapshotVersion; version++ {
+		migrate, ok := snapshotMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from snapshot version %d", version)
+		}
+
+		var err error
+		if data, err = migrate(data); err != nil {
+			return nil, fmt.Errorf("migrate snapshot from version %d: %w", version, err)
+		}
+	}
+
+	return data, nil
+}
+
+// migrateSnapshotV0 убирает из старых снимков мьютекс, сохранявшийся как {}, и пустые строки
+// вместо времени у заглушек родительских комментариев: time.Time их не разбирает.
+func migrateSnapshotV0(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var storage map[string]interface{}
+	if err := decoder.Decode(&storage); err != nil {
+		return nil, err
+	}
+
+	delete(storage, "Mu")
+	dropEmptyTimes(storage)
+
+	return json.Marshal(storage)
+}
+
+// migrateSnapshotV1 переводит вложенные модели в плоские записи. Ответы в старых снимках
+// дублируют комментарии из Comments, поэтому связи берутся только из replyTo.
+func migrateSnapshotV1(data []byte) ([]byte, error) {
+	var storage struct {
+		Posts            map[string]*model.Post
+		Comments         map[string]*model.Comment
+		Users            map[string]*model.User
+		Votes            map[string]map[string]int
+		PostIdCounter    int
+		CommentIdCounter int
+		UserIdCounter    int
+	}
+	if err := json.Unmarshal(data, &storage); err != nil {
+		return nil, err
+	}
+
+	old := &Storage{
+		Posts:            storage.Posts,
+		Comments:         storage.Comments,
+		Users:            storage.Users,
+		Votes:            storage.Votes,
+		PostIdCounter:    storage.PostIdCounter,
+		CommentIdCounter: storage.CommentIdCounter,
+		UserIdCounter:    storage.UserIdCounter,
+	}
+	return json.Marshal(old.snapshot())
+}
+
+func dropEmptyTimes(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if (key == "createdAt" || key == "editedAt" || key == "deletedAt") && field == "" {
+				delete(v, key)
+				continue
+			}
+			dropEmptyTimes(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			dropEmptyTimes(item)
+		}
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return checksumPrefix + hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic пишет данные во временный файл рядом с filename и переименовывает его.
+// rename в пределах каталога атомарен, а fsync файла и каталога переживает падение системы.
+func writeFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// rotateSnapshots сдвигает filename.1 ... filename.keep-1 на один номер и сохраняет текущий снимок
+// как filename.1. Текущий снимок остается на месте до rename нового.
+func rotateSnapshots(filename string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	for i := keep - 1; i >= 1; i-- {
+		err := os.Rename(backupName(filename, i), backupName(filename, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	backup := backupName(filename, 1)
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	//Жесткая ссылка не копирует файл, на файловых системах без ссылок делаем копию
+	if err := os.Link(filename, backup); err == nil {
+		return nil
+	}
+	return copyFile(filename, backup)
+}
+
+func backupName(filename string, i int) string {
+	return fmt.Sprintf("%s.%d", filename, i)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
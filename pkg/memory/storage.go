@@ -1,17 +1,30 @@
 package memory
 
 import (
-	"encoding/json"
-	"os"
 	"ozon-graphql-api/graph/model"
 	"sync"
 )
 
 type Storage struct {
-	Mu       sync.RWMutex
+	Mu       sync.RWMutex `json:"-"`
 	Posts    map[string]*model.Post
 	Comments map[string]*model.Comment
 	Users    map[string]*model.User
+	//Голоса: ключ цели ("post:1", "comment:5") -> id пользователя -> значение голоса (-1 или 1)
+	Votes map[string]map[string]int
+	//Поисковый индекс не сохраняется в файл и строится заново при загрузке
+	Index *SearchIndex `json:"-"`
+	//Журнал изменений после последнего снимка, nil - изменения не журналируются
+	Journal *Journal `json:"-"`
+	//saveMu не дает двум SaveToFile одновременно ротировать и перезаписывать снимки
+	saveMu sync.Mutex
+
+	//Хронологические индексы для лент: все посты, все комментарии, комментарии первого уровня
+	//по id поста и ответы по id родителя. Обновляются вместе с картами в PutPost и PutComment.
+	postOrder    *TimeOrder
+	commentOrder *TimeOrder
+	rootComments map[string]*TimeOrder
+	replies      map[string]*TimeOrder
 
 	/*
 		В базе данных мы используем автоинкременту для каждой из сущностей
@@ -27,12 +40,15 @@ func NewStorage() *Storage {
 		Posts:            make(map[string]*model.Post),
 		Comments:         make(map[string]*model.Comment),
 		Users:            make(map[string]*model.User),
+		Votes:            make(map[string]map[string]int),
+		Index:            NewSearchIndex(),
 		PostIdCounter:    0,
 		CommentIdCounter: 0,
 		UserIdCounter:    3,
 	}
+	storage.initOrders()
 
-	//В нашей системе нет ручек, которые создают юзеров, поэтому добавим несколько в ручную.
+	//Стартовые пользователи, те же, что добавляет первая миграция базы. Новых создает мутация createUser.
 	user1 := &model.User{
 		ID:       "1",
 		Username: "Maxim",
@@ -52,14 +68,74 @@ func NewStorage() *Storage {
 	return storage
 }
 
-func (s *Storage) SaveToFile(filename string) error {
-	s.Mu.RLock()
-	defer s.Mu.RUnlock()
+// initMaps создает карты, которых нет в старых снимках.
+func (s *Storage) initMaps() {
+	if s.Posts == nil {
+		s.Posts = make(map[string]*model.Post)
+	}
+	if s.Comments == nil {
+		s.Comments = make(map[string]*model.Comment)
+	}
+	if s.Users == nil {
+		s.Users = make(map[string]*model.User)
+	}
+	if s.Votes == nil {
+		s.Votes = make(map[string]map[string]int)
+	}
+}
+
+// AttachComment связывает новый комментарий с родителем replyTo: ReplyTo указывает на сам родительский
+// комментарий из Comments, а родитель получает ответ в Replies. Если родителя нет, остается заглушка с id.
+// Вызывается под блокировкой Mu.
+func (s *Storage) AttachComment(comment *model.Comment, replyTo *string) {
+	comment.ReplyTo = nil
+	if replyTo == nil {
+		return
+	}
+
+	parent, ok := s.Comments[*replyTo]
+	if !ok {
+		comment.ReplyTo = &model.Comment{ID: *replyTo}
+		return
+	}
+
+	comment.ReplyTo = parent
+	parent.Replies = append(parent.Replies, comment)
+}
+
+// DetachComment убирает удаляемый комментарий из ответов родителя. Вызывается под блокировкой Mu.
+func (s *Storage) DetachComment(comment *model.Comment) {
+	if comment.ReplyTo == nil {
+		return
+	}
+
+	parent, ok := s.Comments[comment.ReplyTo.ID]
+	if !ok {
+		return
+	}
+	for i, reply := range parent.Replies {
+		if reply.ID == comment.ID {
+			parent.Replies = append(parent.Replies[:i], parent.Replies[i+1:]...)
+			return
+		}
+	}
+}
+
+// DeletePost удаляет пост вместе с голосами за него, как ON DELETE CASCADE в базе. Вызывается под блокировкой Mu.
+func (s *Storage) DeletePost(id string) {
+	s.RemovePost(id)
+	delete(s.Votes, PostKey(id))
+}
 
-	data, err := json.Marshal(s)
-	if err != nil {
-		return err
+// DeleteComment удаляет комментарий из индексов и ответов родителя вместе с голосами за него.
+// Вызывается под блокировкой Mu.
+func (s *Storage) DeleteComment(id string) {
+	comment, ok := s.Comments[id]
+	if !ok {
+		return
 	}
 
-	return os.WriteFile(filename, data, 0644)
+	s.RemoveComment(id)
+	s.DetachComment(comment)
+	delete(s.Votes, CommentKey(id))
 }
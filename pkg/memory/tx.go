@@ -0,0 +1,67 @@
+package memory
+
+import "ozon-graphql-api/graph/model"
+
+/*
+	Репозитории работают с хранилищем через Update и View. Проверки, изменения, индексы и запись
+	в журнал идут в одной критической секции, поэтому параллельные мутации не видят промежуточного
+	состояния и не проходят проверку, которую уже нарушила соседняя мутация.
+*/
+
+// Tx - доступ к хранилищу внутри Update или View. Методы Storage доступны через Tx,
+// блокировку Mu брать внутри нельзя: она уже взята.
+type Tx struct {
+	*Storage
+	writable bool
+	entries  []Entry
+}
+
+// Record откладывает записи журнала до конца Update: изменения транзакции дописываются
+// в журнал одной строкой и воспроизводятся целиком.
+func (tx *Tx) Record(entries ...Entry) {
+	if !tx.writable {
+		panic("memory: Record in read-only transaction")
+	}
+	tx.entries = append(tx.entries, entries...)
+}
+
+// Update выполняет fn под блокировкой на запись и пишет в журнал записи из tx.Record. Откатить
+// изменения в памяти нельзя, поэтому fn проверяет все условия до первого изменения, как
+// репозитории базы проверяют условия до UPDATE. Ошибка fn отменяет запись в журнал.
+func (s *Storage) Update(fn func(tx *Tx) error) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	tx := &Tx{Storage: s, writable: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if len(tx.entries) == 0 {
+		return nil
+	}
+	return s.record(tx.entries...)
+}
+
+// View выполняет fn под блокировкой на чтение.
+func (s *Storage) View(fn func(tx *Tx) error) error {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+
+	return fn(&Tx{Storage: s})
+}
+
+// CopyPost возвращает копию поста для отдачи из транзакции: записи хранилища меняются под
+// блокировкой, а ответ читается резолверами уже без нее.
+func CopyPost(post *model.Post) *model.Post {
+	copied := *post
+	return &copied
+}
+
+// CopyComment - то же для комментария. Ответы отдаются отдельными запросами, поэтому
+// список Replies в копию не попадает, а ReplyTo и Sender указывают на записи с неизменяемым id.
+func CopyComment(comment *model.Comment) *model.Comment {
+	copied := *comment
+	copied.Replies = nil
+	return &copied
+}
@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Policy определяет, что делать с подписчиком, который не успевает вычитывать сообщения.
+type Policy int
+
+const (
+	// DropMessage пропускает сообщение для медленного подписчика, подписка остается жива.
+	DropMessage Policy = iota
+	// Disconnect закрывает канал медленного подписчика.
+	Disconnect
+)
+
+const DefaultBufferSize = 16
+
+type subscriber[T any] struct {
+	ch chan T
+}
+
+// Broker рассылает сообщения всем подписчикам топика. Публикация никогда не блокируется:
+// у каждого подписчика свой ограниченный буфер.
+type Broker[T any] struct {
+	mu         sync.RWMutex
+	topics     map[string]map[*subscriber[T]]struct{}
+	bufferSize int
+	policy     Policy
+}
+
+func NewBroker[T any](bufferSize int, policy Policy) *Broker[T] {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+
+	return &Broker[T]{
+		topics:     make(map[string]map[*subscriber[T]]struct{}),
+		bufferSize: bufferSize,
+		policy:     policy,
+	}
+}
+
+// Subscribe подписывает на топик до отмены ctx. После отмены канал закрывается.
+func (b *Broker[T]) Subscribe(ctx context.Context, topic string) <-chan T {
+	sub := &subscriber[T]{ch: make(chan T, b.bufferSize)}
+
+	b.mu.Lock()
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[*subscriber[T]]struct{})
+		b.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(topic, sub)
+	}()
+
+	return sub.ch
+}
+
+func (b *Broker[T]) Publish(topic string, msg T) {
+	var slow []*subscriber[T]
+
+	b.mu.RLock()
+	for sub := range b.topics[topic] {
+		select {
+		case sub.ch <- msg:
+		default:
+			if b.policy == Disconnect {
+				slow = append(slow, sub)
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range slow {
+		b.unsubscribe(topic, sub)
+	}
+}
+
+// Subscribers возвращает количество активных подписчиков топика.
+func (b *Broker[T]) Subscribers(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.topics[topic])
+}
+
+// unsubscribe закрывает канал под записывающей блокировкой, поэтому Publish
+// никогда не пишет в закрытый канал. Повторный вызов ничего не делает.
+func (b *Broker[T]) unsubscribe(topic string, sub *subscriber[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.topics[topic]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	close(sub.ch)
+
+	if len(subs) == 0 {
+		delete(b.topics, topic)
+	}
+}
@@ -2,108 +2,269 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
-	"github.com/joho/godotenv"
+	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/lib/pq"
-	"github.com/spf13/viper"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"ozon-graphql-api/graph"
+	"ozon-graphql-api/internal/auth"
+	"ozon-graphql-api/internal/config"
+	"ozon-graphql-api/internal/health"
+	"ozon-graphql-api/internal/limits"
+	"ozon-graphql-api/internal/loaders"
 	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
 	"ozon-graphql-api/pkg/database"
 	"ozon-graphql-api/pkg/memory"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
-const defaultPort = "8080"
+// newGraphQLServer повторяет handler.NewDefaultServer, но проверяет токен
+// в connection_init у websocket-подписок, ограничивает глубину и сложность операций
+// и отдает ошибки с кодом в extensions.code.
+func newGraphQLServer(es graphql.ExecutableSchema, authenticator *auth.Authenticator, queryLimits limits.Config, keepAlive time.Duration) *handler.Server {
+	srv := handler.New(es)
 
-const (
-	CONFIG_DIR  = "configs"
-	CONFIG_FILE = "config"
-)
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: keepAlive,
+		InitFunc:              authenticator.WebsocketInitFunc,
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+
+	srv.SetQueryCache(lru.New(1000))
+	srv.SetErrorPresenter(graph.ErrorPresenter)
 
-func initConfig() error {
-	viper.AddConfigPath(CONFIG_DIR)
-	viper.SetConfigName(CONFIG_FILE)
-	return viper.ReadInConfig()
+	srv.Use(extension.Introspection{})
+	srv.Use(limits.New(queryLimits))
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
+
+	return srv
 }
 
-func LoadFromFile(filename string) (*memory.Storage, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
+// closeStaleCommenting раз в минуту закрывает комментарии у постов старше closeAfter.
+// Подписчики узнают об этом через те же события, что и при ручном закрытии.
+func closeStaleCommenting(ctx context.Context, posts repository.PostRepository, closeAfter time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		closed, err := posts.CloseCommentingOlderThan(ctx, closeAfter)
+		if err != nil {
+			log.Printf("error closing commenting on old posts: %v", err)
+		} else if len(closed) > 0 {
+			log.Printf("commenting closed on %d old posts", len(closed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	var s memory.Storage
-	err = json.Unmarshal(data, &s)
-	if err != nil {
-		return nil, err
+// snapshotStorage раз в interval сохраняет снимок хранилища, после чего журнал очищается.
+func snapshotStorage(ctx context.Context, storage *memory.Storage, filename string, keep int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := storage.SaveToFile(filename, keep); err != nil {
+			log.Printf("error saving storage snapshot: %v", err)
+		}
 	}
+}
 
-	return &s, nil
+func dbConfig(cfg config.DBConfig) database.Config {
+	return database.Config{
+		Host:            cfg.Host,
+		Port:            cfg.Port,
+		Username:        cfg.Username,
+		DBName:          cfg.DBName,
+		SSLMode:         cfg.SSLMode,
+		Password:        cfg.Password,
+		AutoMigrate:     cfg.AutoMigrate,
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+	}
 }
 
-func main() {
-	var useMemoryStorage bool
-	flag.BoolVar(&useMemoryStorage, "m", false, "Use in-memory storage")
-	flag.Parse()
+// runMigrate выполняет подкоманду migrate: up применяет все миграции, down [n] откатывает n последних
+// (по умолчанию одну), version печатает текущую версию схемы.
+func runMigrate(args []string, cfg database.Config) error {
+	if len(args) == 0 {
+		return errors.New("usage: server migrate up|down [n]|version")
+	}
+
+	switch args[0] {
+	case "up":
+		return database.MigrateUp(cfg)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations to roll back %q", args[1])
+			}
+			steps = n
+		}
+		return database.Migrate(cfg, func(m *migrate.Migrate) error {
+			return m.Steps(-steps)
+		})
+	case "version":
+		return database.Migrate(cfg, func(m *migrate.Migrate) error {
+			version, dirty, err := m.Version()
+			if errors.Is(err, migrate.ErrNilVersion) {
+				fmt.Println("no migrations applied")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("version %d, dirty %t\n", version, dirty)
+			return nil
+		})
+	}
 
-	if err := initConfig(); err != nil {
-		log.Println(err)
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
+
+func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
 		return
 	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	useMemoryStorage := cfg.Storage.Mode == config.StorageModeMemory
 
-	if err := godotenv.Load("/app/.env"); err != nil {
-		log.Println(err)
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(args[1:], dbConfig(cfg.DB)); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
 		return
 	}
 
 	var repos *repository.Repository
 	var server *http.Server
 	var storage *memory.Storage
+	checker := health.NewChecker(health.DefaultTimeout)
 
 	if useMemoryStorage {
 		log.Println("Service started with using storage")
-		if s, err := LoadFromFile("storage.json"); err == nil {
-			storage = s
-		} else {
-			storage = memory.NewStorage()
+		//Нечитаемый снимок - повод остановиться, а не начать с пустого хранилища
+		s, err := memory.LoadFromFile(cfg.Memory.SnapshotFile, cfg.Memory.JournalFile)
+		if err != nil {
+			log.Fatalf("error loading storage: %v", err)
+		}
+		storage = s
+
+		journal, err := memory.OpenJournal(cfg.Memory.JournalFile, cfg.Memory.JournalSyncInterval)
+		if err != nil {
+			log.Fatalf("error opening storage journal: %v", err)
 		}
+		storage.Journal = journal
+		checker.AddLiveness("journal", health.MemoryJournal(storage))
+		checker.AddReadiness("memory", health.MemoryStorage(storage))
 
 		repos = repository.NewMemoryRepository(storage)
 	} else {
 		log.Println("Service started with using db ")
-		db, err := database.NewPostgresDB(database.Config{
-			Host:     viper.GetString("db.host"),
-			Port:     viper.GetString("db.port"),
-			Username: viper.GetString("db.username"),
-			DBName:   viper.GetString("db.dbname"),
-			SSLMode:  viper.GetString("db.sslmode"),
-			Password: os.Getenv("DB_PASSWORD"),
-		})
+		dbConfig := dbConfig(cfg.DB)
+		db, err := database.NewPostgresDB(dbConfig)
 		if err != nil {
-			log.Println(err)
-			return
+			log.Fatalf("error connecting to db: %v", err)
 		}
-		repos = repository.NewPostgresRepository(db)
+		checker.AddReadiness("postgres", health.Postgres(db))
+		listener := database.NewListener(dbConfig)
+		defer listener.Close()
+
+		repos = repository.NewPostgresRepository(db, listener)
 	}
 
-	port := viper.GetString("http.port")
-	if port == "" {
-		port = defaultPort
+	port := cfg.HTTP.Port
+
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		HS256Secret:        cfg.Auth.HS256Secret,
+		RS256PublicKeyFile: cfg.Auth.RS256PublicKeyFile,
+	})
+	if err != nil {
+		log.Fatalf("error configuring auth: %v", err)
+	}
+	if !authenticator.Enabled() {
+		log.Println("auth keys are not configured, createPost and createComment will be rejected")
 	}
 
-	resolver := graph.NewResolver(repos)
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	resolver := graph.NewResolver(repos, validation.New(validation.Config{
+		MaxTitleLength:    cfg.Validation.MaxTitleLength,
+		MaxPostLength:     cfg.Validation.MaxPostLength,
+		MaxCommentLength:  cfg.Validation.MaxCommentLength,
+		MaxUsernameLength: cfg.Validation.MaxUsernameLength,
+	}))
+
+	//Фоновые задачи останавливаются до финального снимка и закрытия журнала
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	defer stopEvents()
+	background := &sync.WaitGroup{}
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		if err := resolver.ListenCommentEvents(eventsCtx); err != nil {
+			log.Printf("comment events listener stopped: %v", err)
+		}
+	}()
+
+	if closeAfter := cfg.Comments.CloseAfter; closeAfter > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			closeStaleCommenting(eventsCtx, repos.PostRepository, closeAfter)
+		}()
+	}
+	if interval := cfg.Memory.SnapshotInterval; storage != nil && interval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			snapshotStorage(eventsCtx, storage, cfg.Memory.SnapshotFile, cfg.Memory.SnapshotKeep, interval)
+		}()
+	}
+	srv := newGraphQLServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}), authenticator, limits.Config{
+		MaxDepth:      cfg.GraphQL.MaxDepth,
+		MaxComplexity: cfg.GraphQL.MaxComplexity,
+	}, cfg.Subscriptions.KeepAliveInterval)
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", authenticator.Middleware(loaders.Middleware(repos, srv)))
+	http.Handle("/healthz", checker.Liveness())
+	http.Handle("/readyz", checker.Readiness())
 
 	wg := &sync.WaitGroup{}
 
@@ -120,25 +281,37 @@ func main() {
 
 	// graceful shutdown
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, os.Kill)
+	//SIGTERM присылает оркестратор, SIGKILL перехватить нельзя
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
 	log.Println("Shutting down...")
 
+	//Ошибка остановки не должна пропускать финальный снимок и закрытие журнала
+	shutdownFailed := false
+	if err := checker.Shutdown(server, cfg.HTTP.DrainDelay, cfg.HTTP.ShutdownTimeout); err != nil {
+		log.Printf("Server Shutdown Failed:%+v", err)
+		shutdownFailed = true
+	}
+
+	stopEvents()
+	background.Wait()
+
+	//Снимок делается после остановки сервера, чтобы в него попали все мутации
 	if useMemoryStorage && storage != nil {
-		if err := storage.SaveToFile("storage.json"); err != nil {
+		if err := storage.SaveToFile(cfg.Memory.SnapshotFile, cfg.Memory.SnapshotKeep); err != nil {
 			log.Printf("Error saving storage to file: %v", err)
 		}
+		if err := storage.Journal.Close(); err != nil {
+			log.Printf("Error closing storage journal: %v", err)
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	log.Println("Server stopped")
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed:%+v", err)
+	if shutdownFailed {
+		os.Exit(1)
 	}
 
-	log.Println("Server stopped")
-
 	wg.Wait()
 }
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"ozon-graphql-api/internal/auth"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	return token
+}
+
+func validClaims(sub string) jwt.MapClaims {
+	return jwt.MapClaims{"sub": sub, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestAuthenticator_VerifyHS256(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.Config{HS256Secret: testSecret})
+	require.NoError(t, err)
+
+	user, err := authenticator.Verify(signHS256(t, validClaims("1")))
+	require.NoError(t, err)
+	assert.Equal(t, "1", user.ID)
+}
+
+func TestAuthenticator_RejectsExpiredAndUnsignedTokens(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.Config{HS256Secret: testSecret})
+	require.NoError(t, err)
+
+	expired := signHS256(t, jwt.MapClaims{"sub": "1", "exp": time.Now().Add(-time.Hour).Unix()})
+	_, err = authenticator.Verify(expired)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	withoutExp := signHS256(t, jwt.MapClaims{"sub": "1"})
+	_, err = authenticator.Verify(withoutExp)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims("1")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = authenticator.Verify(none)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestAuthenticator_VerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "public.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600)
+	require.NoError(t, err)
+
+	authenticator, err := auth.NewAuthenticator(auth.Config{RS256PublicKeyFile: keyFile})
+	require.NoError(t, err)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims("2")).SignedString(key)
+	require.NoError(t, err)
+
+	user, err := authenticator.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "2", user.ID)
+
+	// HS256 не настроен, значит токен с таким алгоритмом не принимается
+	_, err = authenticator.Verify(signHS256(t, validClaims("2")))
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.Config{HS256Secret: testSecret})
+	require.NoError(t, err)
+
+	var userID string
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = ""
+		if user, ok := auth.UserFromContext(r.Context()); ok {
+			userID = user.ID
+		}
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/query", nil)
+	request.Header.Set("Authorization", "Bearer "+signHS256(t, validClaims("3")))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "3", userID)
+
+	request = httptest.NewRequest(http.MethodPost, "/query", nil)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "", userID)
+
+	request = httptest.NewRequest(http.MethodPost, "/query", nil)
+	request.Header.Set("Authorization", "Bearer broken")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestAuthenticator_WebsocketInit(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.Config{HS256Secret: testSecret})
+	require.NoError(t, err)
+
+	payload := transport.InitPayload{"Authorization": "Bearer " + signHS256(t, validClaims("1"))}
+	ctx, _, err := authenticator.WebsocketInitFunc(context.Background(), payload)
+	require.NoError(t, err)
+
+	user, err := auth.RequireUser(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", user.ID)
+
+	_, _, err = authenticator.WebsocketInitFunc(context.Background(), transport.InitPayload{"Authorization": "broken"})
+	assert.Error(t, err)
+}
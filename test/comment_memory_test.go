@@ -7,35 +7,36 @@ import (
 	"ozon-graphql-api/graph/model"
 	"ozon-graphql-api/internal/repository"
 	"ozon-graphql-api/pkg/memory"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestComments(t *testing.T) {
 	storage := memory.NewStorage()
 
-	storage.Comments["1"] = &model.Comment{
+	storage.PutComment(&model.Comment{
 		ID:        "1",
 		PostID:    "post1",
 		Sender:    &model.User{ID: "1"},
 		ReplyTo:   nil,
 		Text:      "Comment 1",
-		CreatedAt: "2024-09-10T10:00:00Z",
-	}
-	storage.Comments["2"] = &model.Comment{
+		CreatedAt: ts("2024-09-10T10:00:00Z"),
+	})
+	storage.PutComment(&model.Comment{
 		ID:        "2",
 		PostID:    "post1",
 		Sender:    &model.User{ID: "2"},
 		ReplyTo:   nil,
 		Text:      "Comment 2",
-		CreatedAt: "2024-09-11T10:00:00Z",
-	}
+		CreatedAt: ts("2024-09-11T10:00:00Z"),
+	})
 
 	repo := &repository.MemoryCommentRepository{Storage: storage}
 
-	limit := 2
-	offset := 0
+	first := 2
 
-	comments, err := repo.Comments(context.Background(), &limit, &offset)
+	connection, err := repo.Comments(context.Background(), model.CommentSortNew, nil, &first, nil)
 	require.NoError(t, err)
 
 	expectedComments := []*model.Comment{
@@ -45,7 +46,7 @@ func TestComments(t *testing.T) {
 			Sender:    &model.User{ID: "2"},
 			ReplyTo:   nil,
 			Text:      "Comment 2",
-			CreatedAt: "2024-09-11T10:00:00Z",
+			CreatedAt: ts("2024-09-11T10:00:00Z"),
 		},
 		{
 			ID:        "1",
@@ -53,20 +54,66 @@ func TestComments(t *testing.T) {
 			Sender:    &model.User{ID: "1"},
 			ReplyTo:   nil,
 			Text:      "Comment 1",
-			CreatedAt: "2024-09-10T10:00:00Z",
+			CreatedAt: ts("2024-09-10T10:00:00Z"),
 		},
 	}
 
-	assert.ElementsMatch(t, expectedComments, comments)
+	assert.Equal(t, expectedComments, commentNodes(connection))
+	assert.False(t, connection.PageInfo.HasNextPage)
+}
+
+func TestComments_CursorIsStableWhenNewCommentsArrive(t *testing.T) {
+	storage := memory.NewStorage()
+
+	for i, createdAt := range []time.Time{ts("2024-09-10T10:00:00Z"), ts("2024-09-11T10:00:00Z"), ts("2024-09-12T10:00:00Z")} {
+		id := strconv.Itoa(i + 1)
+		storage.PutComment(&model.Comment{ID: id, PostID: "post1", CreatedAt: createdAt})
+	}
+
+	repo := &repository.MemoryCommentRepository{Storage: storage}
+
+	first := 2
+	page, err := repo.Comments(context.Background(), model.CommentSortNew, nil, &first, nil)
+	require.NoError(t, err)
+	require.True(t, page.PageInfo.HasNextPage)
+	require.NotNil(t, page.PageInfo.EndCursor)
+
+	storage.PutComment(&model.Comment{ID: "4", PostID: "post1", CreatedAt: ts("2024-09-13T10:00:00Z")})
+
+	page, err = repo.Comments(context.Background(), model.CommentSortNew, nil, &first, page.PageInfo.EndCursor)
+	require.NoError(t, err)
+
+	nodes := commentNodes(page)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "1", nodes[0].ID)
+	assert.False(t, page.PageInfo.HasNextPage)
+}
+
+func TestComments_InvalidCursor(t *testing.T) {
+	repo := &repository.MemoryCommentRepository{Storage: memory.NewStorage()}
+
+	after := "not a cursor"
+	connection, err := repo.Comments(context.Background(), model.CommentSortNew, nil, nil, &after)
+
+	require.Error(t, err)
+	assert.Nil(t, connection)
+}
+
+func commentNodes(connection *model.CommentConnection) []*model.Comment {
+	var comments []*model.Comment
+	for _, edge := range connection.Edges {
+		comments = append(comments, edge.Node)
+	}
+	return comments
 }
 
 func TestMemoryCreateComment_Success(t *testing.T) {
 	storage := memory.NewStorage()
 
-	storage.Posts["post1"] = &model.Post{
+	storage.PutPost(&model.Post{
 		ID:                    "post1",
 		IsCommentingAvailable: true,
-	}
+	})
 	storage.Users["4"] = &model.User{ID: "4"}
 
 	repo := &repository.MemoryCommentRepository{Storage: storage}
@@ -78,7 +125,7 @@ func TestMemoryCreateComment_Success(t *testing.T) {
 		ReplyTo:  nil,
 	}
 
-	comment, err := repo.CreateComment(context.Background(), input)
+	comment, err := repo.CreateComment(context.Background(), input, anyComment)
 	require.NoError(t, err)
 
 	expectedComment := &model.Comment{
@@ -93,67 +140,143 @@ func TestMemoryCreateComment_Success(t *testing.T) {
 	assert.Equal(t, expectedComment.PostID, comment.PostID)
 	assert.Equal(t, expectedComment.Sender.ID, comment.Sender.ID)
 	assert.Equal(t, expectedComment.Text, comment.Text)
-	assert.True(t, len(comment.CreatedAt) > 0)
+	assert.False(t, comment.CreatedAt.IsZero())
 }
 
-func TestCreateComment_PostNotFound(t *testing.T) {
+func TestCommentsByPost_PagesRootComments(t *testing.T) {
 	storage := memory.NewStorage()
 
+	storage.PutComment(&model.Comment{ID: "1", PostID: "1", CreatedAt: ts("2024-09-10T10:00:00Z")})
+	storage.PutComment(&model.Comment{ID: "2", PostID: "1", CreatedAt: ts("2024-09-11T10:00:00Z")})
+	storage.PutComment(&model.Comment{ID: "3", PostID: "1", CreatedAt: ts("2024-09-12T10:00:00Z"), ReplyTo: &model.Comment{ID: "1"}})
+	storage.PutComment(&model.Comment{ID: "4", PostID: "2", CreatedAt: ts("2024-09-13T10:00:00Z")})
+
 	repo := &repository.MemoryCommentRepository{Storage: storage}
 
-	input := model.NewComment{
-		PostID:   "nonexistentPost",
-		SenderID: "1",
-		Text:     "This comment should fail",
-	}
+	first := 1
+	page, err := repo.CommentsByPost(context.Background(), "1", model.CommentSortOld, &first, nil)
+	require.NoError(t, err)
 
-	comment, err := repo.CreateComment(context.Background(), input)
+	nodes := commentNodes(page)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "1", nodes[0].ID)
+	assert.True(t, page.PageInfo.HasNextPage)
 
-	require.Error(t, err)
-	assert.Nil(t, comment)
-	assert.Equal(t, "post not found", err.Error())
+	page, err = repo.CommentsByPost(context.Background(), "1", model.CommentSortOld, &first, page.PageInfo.EndCursor)
+	require.NoError(t, err)
+
+	nodes = commentNodes(page)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "2", nodes[0].ID)
+	assert.False(t, page.PageInfo.HasNextPage)
 }
 
-func TestCreateComment_CommentingNotAllowed(t *testing.T) {
+func TestRepliesByComment(t *testing.T) {
 	storage := memory.NewStorage()
-	storage.Posts["post1"] = &model.Post{
-		ID:                    "post1",
-		IsCommentingAvailable: false,
-	}
+
+	storage.PutComment(&model.Comment{ID: "1", PostID: "1", CreatedAt: ts("2024-09-10T10:00:00Z")})
+	storage.PutComment(&model.Comment{ID: "2", PostID: "1", CreatedAt: ts("2024-09-11T10:00:00Z"), ReplyTo: &model.Comment{ID: "1"}})
+	storage.PutComment(&model.Comment{ID: "3", PostID: "1", CreatedAt: ts("2024-09-12T10:00:00Z"), ReplyTo: &model.Comment{ID: "2"}})
 
 	repo := &repository.MemoryCommentRepository{Storage: storage}
 
-	input := model.NewComment{
-		PostID:   "post1",
-		SenderID: "1",
-		Text:     "This comment should fail",
-	}
+	page, err := repo.RepliesByComment(context.Background(), "1", model.CommentSortOld, nil, nil)
+	require.NoError(t, err)
+
+	nodes := commentNodes(page)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "2", nodes[0].ID)
+}
+
+func TestMemoryCreateComment_PublishesEvent(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.PutPost(&model.Post{
+		ID:                    "post1",
+		IsCommentingAvailable: true,
+	})
+
+	events := repository.NewMemoryCommentEvents()
+	repo := repository.NewMemoryCommentRepo(storage, events)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan *model.Comment, 1)
+	listening := make(chan struct{})
+	go func() {
+		close(listening)
+		_ = events.Listen(ctx, func(postID string, event model.CommentThreadEvent) {
+			if comment, ok := event.(*model.Comment); ok {
+				received <- comment
+			}
+		})
+	}()
+	<-listening
+
+	// Listen регистрирует обработчик асинхронно, поэтому создаем комментарии, пока событие не придет
+	require.Eventually(t, func() bool {
+		_, err := repo.CreateComment(context.Background(), model.NewComment{
+			PostID:   "post1",
+			SenderID: "1",
+			Text:     "Hello",
+		}, anyComment)
+		require.NoError(t, err)
+		return len(received) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	comment := <-received
+	assert.Equal(t, "post1", comment.PostID)
+	assert.Equal(t, "Hello", comment.Text)
+}
+
+func TestMemoryUpdateComment_OnlyAuthor(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.PutComment(&model.Comment{ID: "1", PostID: "1", Sender: &model.User{ID: "1"}, Text: "Old"})
 
-	comment, err := repo.CreateComment(context.Background(), input)
+	repo := &repository.MemoryCommentRepository{Storage: storage}
 
+	comment, err := repo.UpdateComment(context.Background(), "1", "2", "Hijacked")
 	require.Error(t, err)
 	assert.Nil(t, comment)
-	assert.Equal(t, "commenting is not allowed on this post", err.Error())
+	assert.Equal(t, "only the author can change the comment", err.Error())
+
+	comment, err = repo.UpdateComment(context.Background(), "1", "1", "New")
+	require.NoError(t, err)
+	assert.Equal(t, "New", comment.Text)
+	assert.NotNil(t, comment.EditedAt)
 }
 
-func TestCreateComment_SenderNotFound(t *testing.T) {
+func TestMemoryDeleteComment_TombstoneKeepsReplies(t *testing.T) {
 	storage := memory.NewStorage()
-	storage.Posts["post1"] = &model.Post{
-		ID:                    "post1",
-		IsCommentingAvailable: true,
-	}
+	parent := &model.Comment{ID: "1", PostID: "1", Sender: &model.User{ID: "1"}, Text: "Parent"}
+	reply := &model.Comment{ID: "2", PostID: "1", Sender: &model.User{ID: "2"}, Text: "Reply", ReplyTo: &model.Comment{ID: "1"}}
+	parent.Replies = []*model.Comment{reply}
+	storage.PutComment(parent)
+	storage.PutComment(reply)
 
 	repo := &repository.MemoryCommentRepository{Storage: storage}
 
-	input := model.NewComment{
-		PostID:   "post1",
-		SenderID: "nonexistentUser",
-		Text:     "This comment should fail",
-	}
+	err := repo.DeleteComment(context.Background(), "1", "1")
+	require.NoError(t, err)
+
+	tombstone, ok := storage.Comments["1"]
+	require.True(t, ok)
+	assert.Equal(t, model.DeletedText, tombstone.Text)
+	assert.NotNil(t, tombstone.DeletedAt)
+
+	replies, err := repo.RepliesByComment(context.Background(), "1", model.CommentSortOld, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, replies.Edges, 1)
+
+	// Ответ без своих ответов удаляется полностью
+	err = repo.DeleteComment(context.Background(), "2", "2")
+	require.NoError(t, err)
 
-	comment, err := repo.CreateComment(context.Background(), input)
+	_, ok = storage.Comments["2"]
+	assert.False(t, ok)
+	assert.Empty(t, parent.Replies)
 
+	_, err = repo.UpdateComment(context.Background(), "1", "1", "Resurrected")
 	require.Error(t, err)
-	assert.Nil(t, comment)
-	assert.Equal(t, "sender not found", err.Error())
+	assert.Equal(t, "comment is deleted", err.Error())
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"ozon-graphql-api/graph/model"
 	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/cursor"
 	"testing"
 )
 
@@ -29,16 +30,21 @@ func TestCreateComment_Success(t *testing.T) {
 		ReplyTo:  nil,
 	}
 
-	mock.ExpectQuery(`^SELECT isCommentingAvailable FROM posts WHERE id = \$1$`).
-		WithArgs(input.PostID).
-		WillReturnRows(sqlmock.NewRows([]string{"isCommentingAvailable"}).AddRow(true))
+	mock.ExpectBegin()
+	expectCommentTarget(mock, 101, 1)
 
 	insertQuery := fmt.Sprintf(`^INSERT INTO comments \(postid, sender, text\) VALUES \(\$1, \$2, \$3\) RETURNING id, createdAt$`)
 	mock.ExpectQuery(insertQuery).
-		WithArgs(input.PostID, input.SenderID, input.Text).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "createdAt"}).AddRow(1, "2024-09-09T12:34:56Z"))
+		WithArgs(101, 1, input.Text).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "createdAt"}).AddRow(1, ts("2024-09-09T12:34:56Z")))
 
-	comment, err := repo.CreateComment(context.Background(), input)
+	mock.ExpectExec(`^SELECT pg_notify\(\$1, \$2\)$`).
+		WithArgs("comment_added", `{"type":"commentAdded","id":1,"postId":"101"}`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectCommit()
+
+	comment, err := repo.CreateComment(context.Background(), input, anyComment)
 
 	require.NoError(t, err)
 
@@ -48,7 +54,7 @@ func TestCreateComment_Success(t *testing.T) {
 		Sender:    &model.User{ID: input.SenderID},
 		ReplyTo:   nil,
 		Text:      input.Text,
-		CreatedAt: "2024-09-09T12:34:56Z",
+		CreatedAt: ts("2024-09-09T12:34:56Z"),
 	}
 
 	assert.Equal(t, expectedComment, comment)
@@ -57,6 +63,21 @@ func TestCreateComment_Success(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// anyComment пропускает правила создания: тесты репозиториев проверяют запись, правила проверяет сервис.
+func anyComment(repository.CommentTarget) error {
+	return nil
+}
+
+// expectCommentTarget ожидает чтение открытого поста и существующего отправителя в транзакции вставки.
+func expectCommentTarget(mock sqlmock.Sqlmock, postID, senderID int) {
+	mock.ExpectQuery(`^SELECT isCommentingAvailable, deletedAt FROM posts WHERE id = \$1 FOR SHARE$`).
+		WithArgs(postID).
+		WillReturnRows(sqlmock.NewRows([]string{"iscommentingavailable", "deletedat"}).AddRow(true, nil))
+	mock.ExpectQuery(`^SELECT username FROM users WHERE id = \$1$`).
+		WithArgs(senderID).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("Maxim"))
+}
+
 func TestCreateComment_Error(t *testing.T) {
 	// Мокируем базу данных
 	db, mock, err := sqlmock.New()
@@ -74,11 +95,55 @@ func TestCreateComment_Error(t *testing.T) {
 		ReplyTo:  nil,
 	}
 
-	mock.ExpectQuery(`^SELECT isCommentingAvailable FROM posts WHERE id = \$1$`).
-		WithArgs(input.PostID).
+	mock.ExpectBegin()
+	expectCommentTarget(mock, 101, 1)
+	mock.ExpectQuery(`^INSERT INTO comments \(postid, sender, text\)`).
+		WithArgs(101, 1, input.Text).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	comment, err := repo.CreateComment(context.Background(), input, anyComment)
+
+	require.Error(t, err)
+	assert.Nil(t, comment)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestCreateComment_NotifyErrorRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresCommentRepository{Db: sqlxDB}
+
+	replyTo := "7"
+	input := model.NewComment{
+		PostID:   "101",
+		SenderID: "1",
+		Text:     "This is a reply",
+		ReplyTo:  &replyTo,
+	}
+
+	mock.ExpectBegin()
+	expectCommentTarget(mock, 101, 1)
+	mock.ExpectQuery(`^SELECT postid FROM comments WHERE id = \$1 FOR SHARE$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"postid"}).AddRow(101))
+
+	mock.ExpectQuery(`^INSERT INTO comments \(postid, sender, replyto, text\)`).
+		WithArgs(101, 1, 7, input.Text).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "createdAt"}).AddRow(8, ts("2024-09-09T12:34:56Z")))
+
+	mock.ExpectExec(`^SELECT pg_notify`).
 		WillReturnError(sql.ErrConnDone)
 
-	comment, err := repo.CreateComment(context.Background(), input)
+	mock.ExpectRollback()
+
+	comment, err := repo.CreateComment(context.Background(), input, anyComment)
 
 	require.Error(t, err)
 	assert.Nil(t, comment)
@@ -96,18 +161,17 @@ func TestComments_Success(t *testing.T) {
 
 	repo := &repository.PostgresCommentRepository{Db: sqlxDB}
 
-	limit := 10
-	offset := 0
+	first := 10
 
 	rows := sqlmock.NewRows([]string{"id", "postid", "sender", "replyto", "text", "createdat", "id", "username"}).
-		AddRow(1, 101, 1, nil, "This is a comment", "2024-09-09T12:34:56Z", 1, "user1").
-		AddRow(2, 102, 2, nil, "Another comment", "2024-09-08T12:34:56Z", 2, "user2")
+		AddRow(1, 101, 1, nil, "This is a comment", ts("2024-09-09T12:34:56Z"), 1, "user1").
+		AddRow(2, 102, 2, nil, "Another comment", ts("2024-09-08T12:34:56Z"), 2, "user2")
 
-	mock.ExpectQuery("SELECT c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.id, u.username").
-		WithArgs(limit, offset).
+	mock.ExpectQuery("SELECT c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.username").
+		WithArgs(first + 1).
 		WillReturnRows(rows)
 
-	comments, err := repo.Comments(context.Background(), &limit, &offset)
+	connection, err := repo.Comments(context.Background(), model.CommentSortNew, nil, &first, nil)
 
 	require.NoError(t, err)
 
@@ -118,7 +182,7 @@ func TestComments_Success(t *testing.T) {
 			Sender:    &model.User{ID: "1", Username: "user1"},
 			ReplyTo:   nil,
 			Text:      "This is a comment",
-			CreatedAt: "2024-09-09T12:34:56Z",
+			CreatedAt: ts("2024-09-09T12:34:56Z"),
 		},
 		{
 			ID:        "2",
@@ -126,11 +190,14 @@ func TestComments_Success(t *testing.T) {
 			Sender:    &model.User{ID: "2", Username: "user2"},
 			ReplyTo:   nil,
 			Text:      "Another comment",
-			CreatedAt: "2024-09-08T12:34:56Z",
+			CreatedAt: ts("2024-09-08T12:34:56Z"),
 		},
 	}
 
-	assert.ElementsMatch(t, expectedComments, comments)
+	assert.Equal(t, expectedComments, commentNodes(connection))
+	assert.False(t, connection.PageInfo.HasNextPage)
+	require.NotNil(t, connection.PageInfo.EndCursor)
+	assert.Equal(t, connection.Edges[1].Cursor, *connection.PageInfo.EndCursor)
 
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
@@ -145,18 +212,156 @@ func TestComments_Error(t *testing.T) {
 
 	repo := &repository.PostgresCommentRepository{Db: sqlxDB}
 
-	limit := 10
-	offset := 0
+	first := 10
 
-	mock.ExpectQuery("SELECT c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.id, u.username").
-		WithArgs(limit, offset).
+	mock.ExpectQuery("SELECT c.id, c.postid, c.sender, c.replyto, c.text, c.createdat, u.username").
+		WithArgs(first + 1).
 		WillReturnError(sql.ErrConnDone)
 
-	comments, err := repo.Comments(context.Background(), &limit, &offset)
+	connection, err := repo.Comments(context.Background(), model.CommentSortNew, nil, &first, nil)
+
+	require.Error(t, err)
+	assert.Nil(t, connection)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestCommentsByPost_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresCommentRepository{Db: sqlxDB}
+
+	first := 1
+
+	rows := sqlmock.NewRows([]string{"id", "postid", "sender", "replyto", "text", "createdat", "username"}).
+		AddRow(1, 101, 1, nil, "First", ts("2024-09-08T12:34:56Z"), "user1").
+		AddRow(2, 101, 2, nil, "Second", ts("2024-09-09T12:34:56Z"), "user2")
+
+	mock.ExpectQuery(`WHERE c.postid = \$1 AND c.replyto IS NULL\s+ORDER BY c.createdAt, c.id LIMIT \$2`).
+		WithArgs(101, first+1).
+		WillReturnRows(rows)
+
+	connection, err := repo.CommentsByPost(context.Background(), "101", model.CommentSortOld, &first, nil)
+
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, "1", connection.Edges[0].Node.ID)
+	assert.Equal(t, "user1", connection.Edges[0].Node.Sender.Username)
+	assert.True(t, connection.PageInfo.HasNextPage)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestRepliesByComment_AfterCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresCommentRepository{Db: sqlxDB}
+
+	after := cursor.Encode("2024-09-08T12:34:56Z", "2")
+
+	rows := sqlmock.NewRows([]string{"id", "postid", "sender", "replyto", "text", "createdat", "username"}).
+		AddRow(3, 101, 1, 1, "Reply", ts("2024-09-09T12:34:56Z"), "user1")
+
+	mock.ExpectQuery(`WHERE c.replyto = \$1 AND \(c.createdAt, c.id\) > \(\$2, \$3\)`).
+		WithArgs(1, ts("2024-09-08T12:34:56Z"), 2, 26).
+		WillReturnRows(rows)
+
+	connection, err := repo.RepliesByComment(context.Background(), "1", model.CommentSortOld, nil, &after)
+
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, "3", connection.Edges[0].Node.ID)
+	assert.Equal(t, "1", connection.Edges[0].Node.ReplyTo.ID)
+	assert.False(t, connection.PageInfo.HasNextPage)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestDeleteComment_WithRepliesLeavesTombstone(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresCommentRepository{Db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT sender, deletedAt FROM comments WHERE id = \$1 FOR UPDATE$`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"sender", "deletedAt"}).AddRow(1, nil))
+
+	mock.ExpectExec(`^DELETE FROM comments WHERE id = \$1 AND NOT EXISTS`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec(`^UPDATE comments SET text = \$2, deletedAt = now\(\) WHERE id = \$1$`).
+		WithArgs(5, model.DeletedText).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.DeleteComment(context.Background(), "5", "1")
+	require.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestUpdateComment_NotAuthor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresCommentRepository{Db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT sender, deletedAt FROM comments WHERE id = \$1 FOR UPDATE$`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"sender", "deletedAt"}).AddRow(1, nil))
+	mock.ExpectRollback()
+
+	comment, err := repo.UpdateComment(context.Background(), "5", "2", "Edited")
 
 	require.Error(t, err)
-	assert.Nil(t, comments)
+	assert.Nil(t, comment)
+	assert.Equal(t, "only the author can change the comment", err.Error())
 
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
 }
+
+func TestCommentsByPost_NonNumericID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &repository.PostgresCommentRepository{Db: sqlx.NewDb(db, "postgres")}
+
+	connection, err := repo.CommentsByPost(context.Background(), "abc", model.CommentSortOld, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, connection.Edges)
+	assert.False(t, connection.PageInfo.HasNextPage)
+
+	connection, err = repo.RepliesByComment(context.Background(), "abc", model.CommentSortNew, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, connection.Edges)
+
+	after := cursor.Encode("2024-09-08T12:34:56Z", "abc")
+	_, err = repo.CommentsByPost(context.Background(), "1", model.CommentSortOld, nil, &after)
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"os"
+	"ozon-graphql-api/internal/config"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestConfigLoad_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.yaml", `
+http:
+  port: "8081"
+db:
+  host: "db"
+  max_open_conns: 5
+memory:
+  snapshot_interval: "1m"
+`)
+	t.Setenv("OZON_DB_HOST", "db.internal")
+	t.Setenv("OZON_ENV_FILE", filepath.Join(dir, "missing.env"))
+
+	cfg, args, err := config.Load([]string{"-config", file, "-port", "9090", "-m", "migrate", "up"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"migrate", "up"}, args)
+	assert.Equal(t, "9090", cfg.HTTP.Port)
+	assert.Equal(t, "db.internal", cfg.DB.Host)
+	assert.Equal(t, 5, cfg.DB.MaxOpenConns)
+	assert.Equal(t, config.StorageModeMemory, cfg.Storage.Mode)
+	assert.Equal(t, time.Minute, cfg.Memory.SnapshotInterval)
+	//Ключи, которых нет в файле, берутся по умолчанию
+	assert.Equal(t, "5432", cfg.DB.Port)
+	assert.Equal(t, 10*time.Second, cfg.HTTP.ShutdownTimeout)
+}
+
+func TestConfigLoad_EnvFileAndSecrets(t *testing.T) {
+	dir := t.TempDir()
+	envFile := writeFile(t, dir, ".env", "DB_PASSWORD=from-file\nAUTH_HS256_SECRET=secret\n")
+	//godotenv не перетирает заданные переменные, поэтому заранее очищаем их и возвращаем после теста
+	t.Setenv("DB_PASSWORD", "")
+	t.Setenv("AUTH_HS256_SECRET", "")
+	require.NoError(t, os.Unsetenv("DB_PASSWORD"))
+	require.NoError(t, os.Unsetenv("AUTH_HS256_SECRET"))
+	t.Setenv("OZON_AUTH_HS256_SECRET", "prefixed")
+
+	_, _, err := config.Load([]string{"-config", filepath.Join(dir, "none.yaml"), "-env-file", envFile})
+	require.Error(t, err, "explicit config file must exist")
+
+	cfg, _, err := config.Load([]string{"-env-file", envFile, "-storage", "memory"})
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.DB.Password)
+	assert.Equal(t, "prefixed", cfg.Auth.HS256Secret)
+}
+
+func TestConfigLoad_MissingFilesAreOptional(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("OZON_ENV_FILE", "")
+
+	cfg, _, err := config.Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, config.StorageModePostgres, cfg.Storage.Mode)
+	assert.Equal(t, "8080", cfg.HTTP.Port)
+}
+
+func TestConfigValidate_ListsAllErrors(t *testing.T) {
+	t.Setenv("OZON_ENV_FILE", filepath.Join(t.TempDir(), "missing.env"))
+	t.Setenv("OZON_STORAGE_MODE", "mongo")
+	t.Setenv("OZON_HTTP_PORT", "80a")
+	t.Setenv("OZON_VALIDATION_MAX_TITLE_LENGTH", "300")
+
+	_, _, err := config.Load([]string{"-config", "../configs/config.yaml"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `storage.mode: must be "postgres" or "memory", got "mongo"`)
+	assert.ErrorContains(t, err, `http.port: must be a number from 1 to 65535, got "80a"`)
+	assert.ErrorContains(t, err, "validation.max_title_length: must be from 0 to 255")
+}
+
+func TestConfigValidate_StorageSpecificKeys(t *testing.T) {
+	cfg := config.Config{
+		HTTP:          config.HTTPConfig{Port: "8080", ShutdownTimeout: time.Second},
+		Storage:       config.StorageConfig{Mode: config.StorageModeMemory},
+		Memory:        config.MemoryConfig{SnapshotFile: "storage.json", JournalFile: "storage.json"},
+		Subscriptions: config.SubscriptionsConfig{KeepAliveInterval: time.Second},
+	}
+	assert.ErrorContains(t, cfg.Validate(), "memory.journal_file: must differ from memory.snapshot_file")
+
+	//Для in-memory хранилища настройки базы не нужны
+	cfg.Memory.JournalFile = "storage.journal"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Storage.Mode = config.StorageModePostgres
+	assert.ErrorContains(t, cfg.Validate(), "db.host: is required for postgres storage")
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-graphql-api/pkg/dataloader"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoader_BatchesAndCaches(t *testing.T) {
+	var calls int32
+	var batches [][]string
+	var mu sync.Mutex
+
+	loader := dataloader.New(func(ctx context.Context, keys []string) (map[string]int, error) {
+		atomic.AddInt32(&calls, 1)
+		mu.Lock()
+		batches = append(batches, append([]string(nil), keys...))
+		mu.Unlock()
+
+		result := make(map[string]int)
+		for _, key := range keys {
+			if key != "missing" {
+				result[key] = len(key)
+			}
+		}
+		return result, nil
+	}, 5*time.Millisecond, 0)
+
+	keys := []string{"a", "bb", "ccc", "a", "missing"}
+	results := make([]int, len(keys))
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			value, err := loader.Load(context.Background(), key)
+			require.NoError(t, err)
+			results[i] = value
+		}(i, key)
+	}
+	wg.Wait()
+
+	assert.Equal(t, []int{1, 2, 3, 1, 0}, results)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	sort.Strings(batches[0])
+	assert.Equal(t, []string{"a", "bb", "ccc", "missing"}, batches[0])
+
+	//Повторная загрузка берется из кэша
+	value, err := loader.Load(context.Background(), "bb")
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestLoader_MaxBatch(t *testing.T) {
+	var calls int32
+
+	loader := dataloader.New(func(ctx context.Context, keys []int) (map[int]int, error) {
+		atomic.AddInt32(&calls, 1)
+		//Ключи, пришедшие после заполнения батча, не дописываются в него
+		assert.LessOrEqual(t, len(keys), 2)
+		result := make(map[int]int)
+		for _, key := range keys {
+			result[key] = key * 2
+		}
+		return result, nil
+	}, time.Hour, 2)
+
+	//Ключ, застрявший в батче до часового таймера, роняет тест по таймауту, а не вешает его
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := loader.Load(ctx, i)
+			require.NoError(t, err)
+			assert.Equal(t, i*2, value)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
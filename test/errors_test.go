@@ -0,0 +1,178 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"ozon-graphql-api/graph"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+	"ozon-graphql-api/pkg/memory"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func doPresentedQuery(t *testing.T, repos *repository.Repository, query string) graphqlResponse {
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(repos, validation.New(validation.Config{}))}))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+
+	body, err := json.Marshal(map[string]interface{}{"query": query})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	var response graphqlResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
+
+func TestErrorPresenter_NotFoundCode(t *testing.T) {
+	repos := repository.NewMemoryRepository(memory.NewStorage())
+
+	response := doPresentedQuery(t, repos, `{ postById(id: 42) { id } }`)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "post not found", response.Errors[0].Message)
+	assert.Equal(t, string(apperr.NotFound), response.Errors[0].Extensions["code"])
+	assert.Equal(t, []interface{}{"postById"}, response.Errors[0].Path)
+}
+
+func TestErrorPresenter_UnauthenticatedCode(t *testing.T) {
+	repos := repository.NewMemoryRepository(memory.NewStorage())
+
+	response := doPresentedQuery(t, repos, `mutation { deletePost(id: "1") }`)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "unauthenticated", response.Errors[0].Message)
+	assert.Equal(t, string(apperr.Unauthenticated), response.Errors[0].Extensions["code"])
+}
+
+func TestErrorPresenter_RedactsDriverErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repos := &repository.Repository{
+		PostRepository: &repository.PostgresPostRepository{Db: sqlx.NewDb(db, "postgres")},
+	}
+
+	mock.ExpectQuery(`FROM posts p JOIN users u`).
+		WillReturnError(errors.New(`pq: relation "posts" does not exist`))
+
+	response := doPresentedQuery(t, repos, `{ postById(id: 1) { id } }`)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, "internal error", response.Errors[0].Message)
+	assert.Equal(t, string(apperr.Internal), response.Errors[0].Extensions["code"])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestErrorPresenter_KeepsFrameworkErrors(t *testing.T) {
+	original := &gqlerror.Error{
+		Message:    "operation is too deep",
+		Extensions: map[string]interface{}{"code": "QUERY_TOO_DEEP"},
+	}
+
+	presented := graph.ErrorPresenter(context.Background(), original)
+
+	assert.Equal(t, "operation is too deep", presented.Message)
+	assert.Equal(t, "QUERY_TOO_DEEP", presented.Extensions["code"])
+}
+
+func TestPostByID_NotFoundInBothBackends(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM posts p JOIN users u`).
+		WithArgs(7).
+		WillReturnError(sql.ErrNoRows)
+
+	repos := map[string]repository.PostRepository{
+		"memory":   repository.NewMemoryPostRepo(memory.NewStorage(), nil),
+		"postgres": &repository.PostgresPostRepository{Db: sqlx.NewDb(db, "postgres")},
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			post, err := repo.PostByID(context.Background(), 7)
+
+			assert.Nil(t, post)
+			assert.ErrorIs(t, err, apperr.NotFound)
+			assert.ErrorIs(t, err, repository.ErrPostNotFound)
+			assert.NotErrorIs(t, err, sql.ErrNoRows)
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateComment_PostgresUnknownSender(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &repository.PostgresCommentRepository{Db: sqlx.NewDb(db, "postgres")}
+
+	//Внешний ключ по-прежнему переводится в доменную ошибку, если отправитель пропал после проверки
+	mock.ExpectBegin()
+	expectCommentTarget(mock, 1, 99)
+	mock.ExpectQuery(`^INSERT INTO comments`).
+		WillReturnError(&pq.Error{Code: "23503", Constraint: "comments_sender_fkey"})
+	mock.ExpectRollback()
+
+	comment, err := repo.CreateComment(context.Background(), model.NewComment{PostID: "1", SenderID: "99", Text: "hi"}, anyComment)
+
+	assert.Nil(t, comment)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateUser_ConflictInBothBackends(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`^INSERT INTO users`).
+		WithArgs("alice").
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	storage := memory.NewStorage()
+	storage.Users["1"] = &model.User{ID: "1", Username: "Alice"}
+
+	repos := map[string]repository.UserRepository{
+		"memory":   repository.NewMemoryUserRepo(storage),
+		"postgres": &repository.PostgresUserRepository{Db: sqlx.NewDb(db, "postgres")},
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			user, err := repo.CreateUser(context.Background(), model.NewUser{Username: "alice"})
+
+			assert.Nil(t, user)
+			assert.ErrorIs(t, err, apperr.Conflict)
+			assert.Equal(t, "username already taken", apperr.Message(err))
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
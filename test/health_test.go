@@ -0,0 +1,163 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"ozon-graphql-api/internal/health"
+	"ozon-graphql-api/pkg/memory"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, handler http.Handler) (int, health.Report) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var report health.Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func TestHealth_ReadinessReportsEachDependency(t *testing.T) {
+	checker := health.NewChecker(50 * time.Millisecond)
+	checker.AddReadiness("ok", func(ctx context.Context) error { return nil })
+	checker.AddReadiness("down", func(ctx context.Context) error { return errors.New("connection refused") })
+	checker.AddReadiness("hanging", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, report := probe(t, checker.Readiness())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusFail, report.Status)
+	require.Len(t, report.Checks, 3)
+	assert.Equal(t, health.Result{Status: health.StatusOK, LatencyMs: report.Checks["ok"].LatencyMs}, report.Checks["ok"])
+	assert.Equal(t, "connection refused", report.Checks["down"].Error)
+	//Зависшая зависимость обрывается по таймауту проверки
+	assert.Equal(t, health.StatusFail, report.Checks["hanging"].Status)
+	assert.GreaterOrEqual(t, report.Checks["hanging"].LatencyMs, 50.0)
+
+	//Liveness не зависит от проверок готовности
+	code, report = probe(t, checker.Liveness())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Empty(t, report.Checks)
+}
+
+func TestHealth_DrainFailsReadinessOnly(t *testing.T) {
+	checker := health.NewChecker(0)
+	checker.AddReadiness("ok", func(ctx context.Context) error { return nil })
+
+	code, _ := probe(t, checker.Readiness())
+	require.Equal(t, http.StatusOK, code)
+
+	checker.Drain()
+	code, report := probe(t, checker.Readiness())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusShuttingDown, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["ok"].Status)
+
+	code, _ = probe(t, checker.Liveness())
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestHealth_PostgresPing(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	checker := health.NewChecker(0)
+	checker.AddReadiness("postgres", health.Postgres(sqlx.NewDb(db, "sqlmock")))
+
+	mock.ExpectPing()
+	code, report := probe(t, checker.Readiness())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, report.Checks["postgres"].Status)
+
+	mock.ExpectPing().WillReturnError(errors.New("database is down"))
+	code, report = probe(t, checker.Readiness())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "database is down", report.Checks["postgres"].Error)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHealth_MemoryStorage(t *testing.T) {
+	checker := health.NewChecker(0)
+	checker.AddReadiness("memory", health.MemoryStorage(nil))
+	code, report := probe(t, checker.Readiness())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "storage is not loaded", report.Checks["memory"].Error)
+
+	storage := journaledStorage(t, t.TempDir(), 0)
+	checker = health.NewChecker(0)
+	checker.AddLiveness("journal", health.MemoryJournal(storage))
+	checker.AddReadiness("memory", health.MemoryStorage(storage))
+
+	code, _ = probe(t, checker.Readiness())
+	assert.Equal(t, http.StatusOK, code)
+	code, report = probe(t, checker.Liveness())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, report.Checks, "journal")
+
+	require.NoError(t, storage.Journal.Close())
+	_ = storage.Journal.Append(memory.PostDeleted("1"))
+	code, report = probe(t, checker.Liveness())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, report.Checks["journal"].Error, "journal write failed")
+}
+
+func TestHealth_ShutdownDrainsBeforeClosing(t *testing.T) {
+	checker := health.NewChecker(0)
+	checker.AddReadiness("ok", func(ctx context.Context) error { return nil })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("/readyz", checker.Readiness())
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	url := "http://" + listener.Addr().String() + "/readyz"
+
+	get := func() (int, error) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	code, err := get()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	done := make(chan error, 1)
+	go func() { done <- checker.Shutdown(server, 200*time.Millisecond, time.Second) }()
+
+	//Пока идет пауза, сервер еще принимает запросы, но /readyz уже отвечает 503
+	require.Eventually(t, func() bool {
+		code, err := get()
+		return err == nil && code == http.StatusServiceUnavailable
+	}, 150*time.Millisecond, 5*time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("server stopped before the drain delay: %v", err)
+	default:
+	}
+
+	require.NoError(t, <-done)
+	_, err = get()
+	assert.Error(t, err, "server must not accept connections after shutdown")
+}
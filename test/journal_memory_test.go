@@ -0,0 +1,172 @@
+package test
+
+import (
+	"context"
+	"os"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/memory"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// journaledStorage открывает хранилище так же, как server.go: снимок, журнал поверх него и запись в журнал.
+func journaledStorage(t *testing.T, dir string, syncInterval time.Duration) *memory.Storage {
+	storage, err := memory.LoadFromFile(filepath.Join(dir, "storage.json"), filepath.Join(dir, "storage.journal"))
+	require.NoError(t, err)
+
+	storage.Journal, err = memory.OpenJournal(filepath.Join(dir, "storage.journal"), syncInterval)
+	require.NoError(t, err)
+
+	return storage
+}
+
+// fillStorage делает по мутации каждого вида, в том числе те, что меняют несколько записей.
+func fillStorage(t *testing.T, repos *repository.Repository) {
+	ctx := context.Background()
+
+	user, err := repos.CreateUser(ctx, model.NewUser{Username: "Journal"})
+	require.NoError(t, err)
+
+	post, err := repos.CreatePost(ctx, model.NewPost{Title: "Title", Text: "Text", UserID: user.ID, IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+	_, err = repos.CreatePost(ctx, model.NewPost{Title: "Removed", Text: "Text", UserID: user.ID, IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+	require.NoError(t, repos.DeletePost(ctx, "2", user.ID))
+
+	title := "Edited"
+	_, err = repos.UpdatePost(ctx, post.ID, user.ID, model.UpdatePost{Title: &title})
+	require.NoError(t, err)
+
+	root, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "1", Text: "Root"}, anyComment)
+	require.NoError(t, err)
+	reply, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: user.ID, ReplyTo: &root.ID, Text: "Reply"}, anyComment)
+	require.NoError(t, err)
+	leaf, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: user.ID, ReplyTo: &root.ID, Text: "Leaf"}, anyComment)
+	require.NoError(t, err)
+	require.NoError(t, repos.DeleteComment(ctx, leaf.ID, user.ID))
+	require.NoError(t, repos.DeleteComment(ctx, root.ID, "1"))
+	_, err = repos.UpdateComment(ctx, reply.ID, user.ID, "Edited reply")
+	require.NoError(t, err)
+
+	_, err = repos.Vote(ctx, model.VoteTargetComment, reply.ID, "2", -1)
+	require.NoError(t, err)
+	_, err = repos.Vote(ctx, model.VoteTargetComment, reply.ID, "2", 0)
+	require.NoError(t, err)
+
+	_, err = repos.SetCommentingAvailable(ctx, post.ID, user.ID, false)
+	require.NoError(t, err)
+
+	_, err = repos.Vote(ctx, model.VoteTargetPost, post.ID, "1", 1)
+	require.NoError(t, err)
+}
+
+func assertSameStorage(t *testing.T, expected, actual *memory.Storage) {
+	assert.Equal(t, expected.Posts, actual.Posts)
+	assert.Equal(t, expected.Comments, actual.Comments)
+	assert.Equal(t, expected.Users, actual.Users)
+	assert.Equal(t, expected.Votes, actual.Votes)
+	assert.Equal(t, expected.PostIdCounter, actual.PostIdCounter)
+	assert.Equal(t, expected.CommentIdCounter, actual.CommentIdCounter)
+	assert.Equal(t, expected.UserIdCounter, actual.UserIdCounter)
+}
+
+func TestMemoryJournal_ReplayAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+
+	storage := journaledStorage(t, dir, 0)
+	fillStorage(t, repository.NewMemoryRepository(storage))
+	//Падение: снимок не сохранен, на диске только журнал
+	require.NoError(t, storage.Journal.Close())
+	_, err := os.Stat(filepath.Join(dir, "storage.json"))
+	require.True(t, os.IsNotExist(err))
+
+	restored := journaledStorage(t, dir, 0)
+	defer restored.Journal.Close()
+
+	assertSameStorage(t, storage, restored)
+	assert.NotEmpty(t, restored.Search("edited"))
+
+	//Счетчики восстановлены, новые записи не занимают старые id
+	post, err := repository.NewMemoryRepository(restored).CreatePost(context.Background(), model.NewPost{Title: "Next", Text: "Text", UserID: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "3", post.ID)
+}
+
+func TestMemoryJournal_SnapshotTruncatesJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	storage := journaledStorage(t, dir, 0)
+	repos := repository.NewMemoryRepository(storage)
+	fillStorage(t, repos)
+
+	require.NoError(t, storage.SaveToFile(filepath.Join(dir, "storage.json"), 0))
+	info, err := os.Stat(filepath.Join(dir, "storage.journal"))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	//Изменения после снимка воспроизводятся поверх него
+	_, err = repos.CreateUser(context.Background(), model.NewUser{Username: "AfterSnapshot"})
+	require.NoError(t, err)
+	require.NoError(t, storage.Journal.Close())
+
+	restored := journaledStorage(t, dir, 0)
+	defer restored.Journal.Close()
+
+	assert.Equal(t, storage.Users, restored.Users)
+	assert.Equal(t, storage.Votes, restored.Votes)
+	assert.Len(t, restored.Posts, len(storage.Posts))
+	assert.Len(t, restored.Comments, len(storage.Comments))
+}
+
+func TestMemoryJournal_TornTailIsDropped(t *testing.T) {
+	dir := t.TempDir()
+	journalFile := filepath.Join(dir, "storage.journal")
+
+	storage := journaledStorage(t, dir, 0)
+	_, err := repository.NewMemoryRepository(storage).CreateUser(context.Background(), model.NewUser{Username: "Saved"})
+	require.NoError(t, err)
+	require.NoError(t, storage.Journal.Close())
+
+	complete, err := os.ReadFile(journalFile)
+	require.NoError(t, err)
+	torn := append(complete, []byte(`[{"op":"save_user","user":{"id":"5","user`)...)
+	require.NoError(t, os.WriteFile(journalFile, torn, 0644))
+
+	restored, err := memory.LoadFromFile(filepath.Join(dir, "storage.json"), journalFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Saved", restored.Users["4"].Username)
+	assert.NotContains(t, restored.Users, "5")
+
+	data, err := os.ReadFile(journalFile)
+	require.NoError(t, err)
+	assert.Equal(t, complete, data)
+}
+
+func TestMemoryJournal_CorruptEntryFailsLoad(t *testing.T) {
+	dir := t.TempDir()
+	journalFile := filepath.Join(dir, "storage.journal")
+
+	require.NoError(t, os.WriteFile(journalFile, []byte("not json\n"+`[{"op":"save_user","user":{"id":"4","username":"Lost"}}]`+"\n"), 0644))
+
+	_, err := memory.LoadFromFile(filepath.Join(dir, "storage.json"), journalFile)
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestMemoryJournal_BatchedSyncFlushesOnClose(t *testing.T) {
+	dir := t.TempDir()
+
+	storage := journaledStorage(t, dir, time.Hour)
+	_, err := repository.NewMemoryRepository(storage).CreateUser(context.Background(), model.NewUser{Username: "Batched"})
+	require.NoError(t, err)
+	require.NoError(t, storage.Journal.Close())
+
+	restored, err := memory.LoadFromFile(filepath.Join(dir, "storage.json"), filepath.Join(dir, "storage.journal"))
+	require.NoError(t, err)
+	assert.Equal(t, "Batched", restored.Users["4"].Username)
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"ozon-graphql-api/graph"
+	"ozon-graphql-api/internal/limits"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+	"ozon-graphql-api/pkg/memory"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func doLimitedQuery(t *testing.T, cfg limits.Config, query string, variables map[string]interface{}) graphqlResponse {
+	repos := repository.NewMemoryRepository(memory.NewStorage())
+
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(repos, validation.New(validation.Config{}))}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.Use(limits.New(cfg))
+
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	var response graphqlResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
+
+func TestLimits_RejectsDeepReplies(t *testing.T) {
+	query := `{ comments { edges { node { replies { edges { node { replies { edges { node { id } } } } } } } } } }`
+
+	response := doLimitedQuery(t, limits.Config{MaxDepth: 8}, query, nil)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, limits.CodeTooDeep, response.Errors[0].Extensions["code"])
+	assert.Equal(t, float64(10), response.Errors[0].Extensions["depth"])
+	assert.Equal(t, []interface{}{"comments", "edges", "node", "replies", "edges", "node", "replies", "edges", "node", "id"}, response.Errors[0].Path)
+}
+
+func TestLimits_ComplexityNamesExpensiveField(t *testing.T) {
+	query := `query($size: Int) { posts(first: 5) { edges { node { comments(first: $size) { edges { node { id } } } } } } }`
+
+	response := doLimitedQuery(t, limits.Config{MaxComplexity: 1000}, query, map[string]interface{}{"size": 1000})
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, limits.CodeTooComplex, response.Errors[0].Extensions["code"])
+	assert.Equal(t, float64(15016), response.Errors[0].Extensions["complexity"])
+	assert.Equal(t, float64(3001), response.Errors[0].Extensions["fieldCost"])
+	assert.Equal(t, []interface{}{"posts", "edges", "node", "comments"}, response.Errors[0].Path)
+}
+
+func TestLimits_AllowsQueriesWithinBudget(t *testing.T) {
+	cfg := limits.Config{MaxDepth: 6, MaxComplexity: 100}
+
+	response := doLimitedQuery(t, cfg, `{ posts(first: 10) { edges { node { id title } } } }`, nil)
+	assert.Empty(t, response.Errors)
+
+	//Интроспекция глубже лимита, но не учитывается
+	response = doLimitedQuery(t, cfg, `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`, nil)
+	assert.Empty(t, response.Errors)
+}
+
+// TestLimits_HugeFirstDoesNotOverflow: стоимость вложенных страниц насыщается, а не переполняет int,
+// поэтому огромный first не превращается в отрицательную стоимость внутри бюджета.
+func TestLimits_HugeFirstDoesNotOverflow(t *testing.T) {
+	query := `query($size: Int) { posts(first: $size) { edges { node { comments(first: $size) { edges { node {
+		replies(first: $size) { edges { node { replies(first: $size) { edges { node { id } } } } } } } } } } } } }`
+
+	for _, size := range []interface{}{1500007, int64(1) << 40} {
+		response := doLimitedQuery(t, limits.Config{MaxComplexity: 10000}, query, map[string]interface{}{"size": size})
+
+		require.Len(t, response.Errors, 1, size)
+		assert.Equal(t, limits.CodeTooComplex, response.Errors[0].Extensions["code"])
+		assert.Equal(t, float64(math.MaxInt32), response.Errors[0].Extensions["complexity"])
+	}
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"ozon-graphql-api/graph"
+	"ozon-graphql-api/internal/loaders"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoaders_OneQueryPerLevel проверяет, что вложенные поля страницы постов
+// загружаются одним запросом на уровень, а не запросом на каждый пост или комментарий.
+func TestLoaders_OneQueryPerLevel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repos := repository.NewPostgresRepository(sqlx.NewDb(db, "postgres"), nil)
+
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(repos, validation.New(validation.Config{}))}))
+	srv.AddTransport(transport.POST{})
+
+	commentColumns := []string{"id", "postid", "sender", "replyto", "text", "createdat", "username", "parent", "rn"}
+
+	mock.ExpectQuery("FROM posts p JOIN users u").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "text", "createdat", "iscommentingavailable", "userid", "username"}).
+			AddRow(1, "Title1", "Text1", ts("2024-09-09T12:00:00Z"), true, 1, "Maxim").
+			AddRow(2, "Title2", "Text2", ts("2024-09-08T12:00:00Z"), true, 2, "Vika"))
+
+	mock.ExpectQuery(`WHERE c.postid = ANY\(\$1\) AND c.replyto IS NULL`).
+		WithArgs(sqlmock.AnyArg(), 26).
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow(10, 1, 1, nil, "Comment10", ts("2024-09-09T13:00:00Z"), "Maxim", 1, 1).
+			AddRow(11, 1, 2, nil, "Comment11", ts("2024-09-09T14:00:00Z"), "Vika", 1, 2).
+			AddRow(12, 2, 3, nil, "Comment12", ts("2024-09-08T13:00:00Z"), "Ruslan", 2, 1))
+
+	mock.ExpectQuery(`WHERE c.replyto = ANY\(\$1\)`).
+		WithArgs(sqlmock.AnyArg(), 26).
+		WillReturnRows(sqlmock.NewRows(commentColumns).
+			AddRow(20, 1, 2, 10, "Reply20", ts("2024-09-09T15:00:00Z"), "Vika", 10, 1).
+			AddRow(21, 2, 1, 12, "Reply21", ts("2024-09-08T15:00:00Z"), "Maxim", 12, 1))
+
+	mock.ExpectQuery(`WHERE c.id = ANY\(\$1\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "postid", "sender", "replyto", "text", "createdat", "username"}).
+			AddRow(10, 1, 1, nil, "Comment10", ts("2024-09-09T13:00:00Z"), "Maxim").
+			AddRow(12, 2, 3, nil, "Comment12", ts("2024-09-08T13:00:00Z"), "Ruslan"))
+
+	query := `{ posts { edges { node { id createdBy { username }
+                comments { edges { node { id replies { edges { node { id replyTo { text } } } } } } } } } } }`
+	body, err := json.Marshal(map[string]string{"query": query})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	loaders.Middleware(repos, srv).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `"errors"`)
+	assert.Contains(t, rec.Body.String(), `{"id":"21","replyTo":{"text":"Comment12"}}`)
+	assert.Contains(t, rec.Body.String(), `"createdBy":{"username":"Vika"}`)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
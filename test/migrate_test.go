@@ -0,0 +1,61 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"ozon-graphql-api/pkg/database"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSchemaSource_EmbedsAllMigrations проверяет, что в бинарник попали все миграции из каталога схемы
+// и у каждой есть откат.
+func TestSchemaSource_EmbedsAllMigrations(t *testing.T) {
+	files, err := filepath.Glob("../pkg/database/schema/*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	src, err := database.SchemaSource()
+	require.NoError(t, err)
+	defer src.Close()
+
+	var versions []uint
+	version, next := src.First()
+	for next == nil {
+		versions = append(versions, version)
+
+		up, _, err := src.ReadUp(version)
+		require.NoError(t, err, "up %d", version)
+		assertMatchesFile(t, up, "up", version)
+
+		down, _, err := src.ReadDown(version)
+		require.NoError(t, err, "down %d", version)
+		assertMatchesFile(t, down, "down", version)
+
+		version, next = src.Next(version)
+	}
+	require.True(t, errors.Is(next, os.ErrNotExist), next)
+
+	assert.Len(t, versions, len(files))
+	assert.Equal(t, uint(1), versions[0])
+}
+
+func assertMatchesFile(t *testing.T, migration io.ReadCloser, direction string, version uint) {
+	defer migration.Close()
+
+	embedded, err := io.ReadAll(migration)
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(fmt.Sprintf("../pkg/database/schema/%06d_*.%s.sql", version, direction))
+	require.NoError(t, err)
+	require.Len(t, files, 1, "%s migration %d", direction, version)
+
+	onDisk, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, string(onDisk), string(embedded), files[0])
+}
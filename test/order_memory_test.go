@@ -0,0 +1,232 @@
+package test
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/memory"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func orderIDs(order *memory.TimeOrder, after *memory.OrderKey, period *model.DateRange, desc bool) []string {
+	var ids []string
+	collect := func(id string) bool {
+		ids = append(ids, id)
+		return true
+	}
+	if desc {
+		order.Descend(after, period, collect)
+	} else {
+		order.Ascend(after, period, collect)
+	}
+	return ids
+}
+
+func TestTimeOrder_RangeAndCursor(t *testing.T) {
+	order := &memory.TimeOrder{}
+	//Вставка не по порядку и записи с одинаковым временем: порядок определяет id
+	for _, key := range []memory.OrderKey{
+		{CreatedAt: ts("2024-09-12T10:00:00Z"), ID: "4"},
+		{CreatedAt: ts("2024-09-10T10:00:00Z"), ID: "1"},
+		{CreatedAt: ts("2024-09-11T10:00:00Z"), ID: "10"},
+		{CreatedAt: ts("2024-09-11T10:00:00Z"), ID: "9"},
+	} {
+		order.Insert(key)
+	}
+	order.Insert(memory.OrderKey{CreatedAt: ts("2024-09-10T10:00:00Z"), ID: "1"})
+	require.Equal(t, 4, order.Len())
+
+	assert.Equal(t, []string{"1", "9", "10", "4"}, orderIDs(order, nil, nil, false))
+	assert.Equal(t, []string{"4", "10", "9", "1"}, orderIDs(order, nil, nil, true))
+
+	after := &memory.OrderKey{CreatedAt: ts("2024-09-11T10:00:00Z"), ID: "9"}
+	assert.Equal(t, []string{"10", "4"}, orderIDs(order, after, nil, false))
+	assert.Equal(t, []string{"1"}, orderIDs(order, after, nil, true))
+
+	from, to := ts("2024-09-11T10:00:00Z"), ts("2024-09-12T10:00:00Z")
+	period := &model.DateRange{From: &from, To: &to}
+	assert.Equal(t, []string{"9", "10"}, orderIDs(order, nil, period, false))
+	assert.Equal(t, []string{"10", "9"}, orderIDs(order, nil, period, true))
+	assert.Equal(t, []string{"9"}, orderIDs(order, &memory.OrderKey{CreatedAt: from, ID: "10"}, period, true))
+
+	order.Remove(memory.OrderKey{CreatedAt: ts("2024-09-11T10:00:00Z"), ID: "10"})
+	order.Remove(memory.OrderKey{CreatedAt: ts("2024-09-11T10:00:00Z"), ID: "missing"})
+	assert.Equal(t, []string{"1", "9", "4"}, orderIDs(order, nil, nil, false))
+}
+
+func TestMemoryStorage_IndexesFollowMutations(t *testing.T) {
+	storage := memory.NewStorage()
+	repos := repository.NewMemoryRepository(storage)
+	ctx := context.Background()
+
+	post, err := repos.CreatePost(ctx, model.NewPost{Title: "Title", Text: "Text", UserID: "1", IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+	root, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "1", Text: "Root"}, anyComment)
+	require.NoError(t, err)
+	reply, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "2", ReplyTo: &root.ID, Text: "Reply"}, anyComment)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, storage.RootComments(post.ID).Len())
+	assert.Equal(t, 1, storage.RepliesTo(root.ID).Len())
+	assert.Equal(t, 2, storage.CommentsByTime().Len())
+
+	//Родитель с ответом становится надгробием и остается в индексе, ответ удаляется из индексов
+	require.NoError(t, repos.DeleteComment(ctx, root.ID, "1"))
+	require.NoError(t, repos.DeleteComment(ctx, reply.ID, "2"))
+	assert.Equal(t, 0, storage.RepliesTo(root.ID).Len())
+	assert.Equal(t, 1, storage.RootComments(post.ID).Len())
+	assert.Equal(t, 1, storage.CommentsByTime().Len())
+
+	replies, err := repos.RepliesByComment(ctx, root.ID, model.CommentSortOld, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, replies.Edges)
+
+	empty, err := repos.CreatePost(ctx, model.NewPost{Title: "Empty", Text: "Text", UserID: "1"})
+	require.NoError(t, err)
+	require.NoError(t, repos.DeletePost(ctx, empty.ID, "1"))
+	assert.Equal(t, 1, storage.PostsByTime().Len())
+
+	posts, err := repos.Posts(ctx, model.PostSortNew, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, posts.Edges, 1)
+	assert.Equal(t, post.ID, posts.Edges[0].Node.ID)
+}
+
+const (
+	benchPosts    = 1000
+	benchComments = 200000
+)
+
+// benchStorage строит хранилище на 200k комментариев: у каждого поста четверть комментариев
+// первого уровня, остальные - ответы на них. Голоса разные, чтобы ленты по рейтингу не вырождались в хронологию.
+func benchStorage(b *testing.B) *memory.Storage {
+	b.Helper()
+
+	storage := memory.NewStorage()
+	start := ts("2024-01-01T00:00:00Z")
+	for i := 1; i <= benchPosts; i++ {
+		id := strconv.Itoa(i)
+		storage.PutPost(&model.Post{ID: id, CreatedBy: storage.Users["1"], CreatedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	for i := 1; i <= benchComments; i++ {
+		id := strconv.Itoa(i)
+		postID := strconv.Itoa(i%benchPosts + 1)
+		comment := &model.Comment{ID: id, PostID: postID, Sender: storage.Users["2"], CreatedAt: start.Add(time.Duration(i) * time.Millisecond),
+			Upvotes: i % 97, Downvotes: i % 31}
+		if i > benchPosts*50 {
+			parent := strconv.Itoa(i%(benchPosts*50) + 1)
+			comment.PostID = storage.Comments[parent].PostID
+			storage.AttachComment(comment, &parent)
+		}
+		storage.PutComment(comment)
+	}
+
+	b.ResetTimer()
+	return storage
+}
+
+func BenchmarkMemoryCommentsByPost(b *testing.B) {
+	repo := repository.NewMemoryCommentRepo(benchStorage(b), nil)
+	first := 25
+
+	for i := 0; i < b.N; i++ {
+		postID := strconv.Itoa(i%benchPosts + 1)
+		if _, err := repo.CommentsByPost(context.Background(), postID, model.CommentSortOld, &first, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemoryComments(b *testing.B) {
+	repo := repository.NewMemoryCommentRepo(benchStorage(b), nil)
+	first := 25
+
+	var after *string
+	for i := 0; i < b.N; i++ {
+		page, err := repo.Comments(context.Background(), model.CommentSortNew, nil, &first, after)
+		if err != nil {
+			b.Fatal(err)
+		}
+		after = page.PageInfo.EndCursor
+		if !page.PageInfo.HasNextPage {
+			after = nil
+		}
+	}
+}
+
+// BenchmarkMemoryCommentsFullScan - прежний способ для сравнения: обход всей карты и сортировка на каждый запрос.
+func BenchmarkMemoryCommentsFullScan(b *testing.B) {
+	storage := benchStorage(b)
+
+	for i := 0; i < b.N; i++ {
+		postID := strconv.Itoa(i%benchPosts + 1)
+
+		storage.Mu.RLock()
+		var comments []*model.Comment
+		for _, comment := range storage.Comments {
+			if comment.PostID == postID && comment.ReplyTo == nil {
+				comments = append(comments, comment)
+			}
+		}
+		sort.Slice(comments, func(i, j int) bool { return comments[i].CreatedAt.Before(comments[j].CreatedAt) })
+		storage.Mu.RUnlock()
+	}
+}
+
+// BenchmarkMemoryCommentsRanked листает общую ленту комментариев по рейтингу. Индекса по рейтингу нет:
+// каждая страница обходит все 200k записей и держит в куче только size+1 лучших.
+func BenchmarkMemoryCommentsRanked(b *testing.B) {
+	for _, sort := range []model.CommentSort{model.CommentSortTop, model.CommentSortHot, model.CommentSortControversial} {
+		b.Run(string(sort), func(b *testing.B) {
+			repo := repository.NewMemoryCommentRepo(benchStorage(b), nil)
+			first := 25
+
+			var after *string
+			for i := 0; i < b.N; i++ {
+				page, err := repo.Comments(context.Background(), sort, nil, &first, after)
+				if err != nil {
+					b.Fatal(err)
+				}
+				after = page.PageInfo.EndCursor
+				if !page.PageInfo.HasNextPage {
+					after = nil
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMemoryCommentsByPostRanked - лента комментариев первого уровня поста по рейтингу: обходится только индекс поста.
+func BenchmarkMemoryCommentsByPostRanked(b *testing.B) {
+	repo := repository.NewMemoryCommentRepo(benchStorage(b), nil)
+	first := 25
+
+	for i := 0; i < b.N; i++ {
+		postID := strconv.Itoa(i%benchPosts + 1)
+		if _, err := repo.CommentsByPost(context.Background(), postID, model.CommentSortTop, &first, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMemoryCommentsRankedFullSort - прежний способ для сравнения: сортировка всей ленты по рейтингу на каждую страницу.
+func BenchmarkMemoryCommentsRankedFullSort(b *testing.B) {
+	storage := benchStorage(b)
+
+	for i := 0; i < b.N; i++ {
+		storage.Mu.RLock()
+		comments := make([]*model.Comment, 0, len(storage.Comments))
+		for _, comment := range storage.Comments {
+			comments = append(comments, comment)
+		}
+		sort.Slice(comments, func(i, j int) bool { return comments[i].Score() > comments[j].Score() })
+		storage.Mu.RUnlock()
+	}
+}
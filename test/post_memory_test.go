@@ -6,8 +6,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"ozon-graphql-api/graph/model"
 	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/service"
+	"ozon-graphql-api/internal/validation"
 	"ozon-graphql-api/pkg/memory"
 	"testing"
+	"time"
 )
 
 func TestMemoryCreatePost_Success(t *testing.T) {
@@ -37,38 +40,138 @@ func TestMemoryCreatePost_Success(t *testing.T) {
 		CreatedBy:             &model.User{ID: "1"},
 		CreatedAt:             post.CreatedAt,
 		IsCommentingAvailable: true,
-		Comments:              []*model.Comment{},
 	}
 
 	assert.Equal(t, expectedPost.Title, post.Title)
 	assert.Equal(t, expectedPost.Text, post.Text)
 	assert.Equal(t, expectedPost.CreatedBy.ID, post.CreatedBy.ID)
-	assert.True(t, len(post.CreatedAt) > 0)
+	assert.False(t, post.CreatedAt.IsZero())
 
 	storedPost, exists := storage.Posts[post.ID]
 	require.True(t, exists)
 	assert.Equal(t, post, storedPost)
 }
 
-func TestCreatePost_UserNotFound(t *testing.T) {
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestMemoryUpdatePost(t *testing.T) {
 	storage := memory.NewStorage()
+	storage.PutPost(&model.Post{ID: "1", Title: "Title", Text: "Text", CreatedBy: &model.User{ID: "1"}})
 
 	repo := &repository.MemoryPostRepository{Storage: storage}
 
-	input := model.NewPost{
-		Title:                 "New Post",
-		Text:                  "This is a new post.",
-		UserID:                "nonexistentUser",
-		IsCommentingAvailable: boolPtr(true),
-	}
+	title := "New title"
+	post, err := repo.UpdatePost(context.Background(), "1", "1", model.UpdatePost{Title: &title})
+	require.NoError(t, err)
+	assert.Equal(t, "New title", post.Title)
+	assert.Equal(t, "Text", post.Text)
+	assert.NotNil(t, post.EditedAt)
 
-	post, err := repo.CreatePost(context.Background(), input)
+	_, err = repo.UpdatePost(context.Background(), "1", "2", model.UpdatePost{Title: &title})
+	require.Error(t, err)
+	assert.Equal(t, "only the author can change the post", err.Error())
+}
+
+func TestMemoryDeletePost(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.PutPost(&model.Post{ID: "1", Title: "Empty", CreatedBy: &model.User{ID: "1"}, IsCommentingAvailable: true})
+	storage.PutPost(&model.Post{ID: "2", Title: "Discussed", CreatedBy: &model.User{ID: "1"}, IsCommentingAvailable: true})
+	storage.PutComment(&model.Comment{ID: "1", PostID: "2", Sender: &model.User{ID: "2"}})
+
+	repo := &repository.MemoryPostRepository{Storage: storage}
+
+	require.NoError(t, repo.DeletePost(context.Background(), "1", "1"))
+	_, ok := storage.Posts["1"]
+	assert.False(t, ok)
+
+	require.NoError(t, repo.DeletePost(context.Background(), "2", "1"))
+	tombstone, ok := storage.Posts["2"]
+	require.True(t, ok)
+	assert.Equal(t, model.DeletedText, tombstone.Title)
+	assert.False(t, tombstone.IsCommentingAvailable)
+	assert.NotNil(t, tombstone.DeletedAt)
+}
+
+func TestMemorySetCommentingAvailable_PublishesEvent(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.PutPost(&model.Post{ID: "1", CreatedBy: &model.User{ID: "1"}, IsCommentingAvailable: true})
 
+	events := repository.NewMemoryCommentEvents()
+	repo := repository.NewMemoryPostRepo(storage, events)
+	comments := repository.NewMemoryCommentRepo(storage, events)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan model.CommentThreadEvent, 4)
+	go func() {
+		_ = events.Listen(ctx, func(postID string, event model.CommentThreadEvent) {
+			received <- event
+		})
+	}()
+
+	_, err := repo.SetCommentingAvailable(context.Background(), "1", "2", false)
 	require.Error(t, err)
-	assert.Nil(t, post)
-	assert.Equal(t, "user doesn't exists", err.Error())
+	assert.Equal(t, "only the author can change the post", err.Error())
+
+	// Listen регистрирует обработчик асинхронно, поэтому переключаем, пока событие не придет
+	available := false
+	require.Eventually(t, func() bool {
+		post, err := repo.SetCommentingAvailable(context.Background(), "1", "1", available)
+		require.NoError(t, err)
+		assert.Equal(t, available, post.IsCommentingAvailable)
+		available = !available
+		return len(received) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	event, ok := (<-received).(*model.CommentingAvailabilityChanged)
+	require.True(t, ok)
+	assert.Equal(t, "1", event.PostID)
+
+	_, err = repo.SetCommentingAvailable(context.Background(), "1", "1", false)
+	require.NoError(t, err)
+
+	commentService := service.NewCommentService(&repository.Repository{
+		PostRepository:    repo,
+		CommentRepository: comments,
+		UserRepository:    repository.NewMemoryUserRepo(storage),
+	}, validation.New(validation.Config{}))
+
+	_, err = commentService.CreateComment(context.Background(), model.NewComment{PostID: "1", SenderID: "1", Text: "Late"})
+	require.Error(t, err)
+	assert.Equal(t, "commenting is not allowed on this post", err.Error())
 }
 
-func boolPtr(b bool) *bool {
-	return &b
+func TestMemoryCloseCommentingOlderThan(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.PutPost(&model.Post{ID: "1", IsCommentingAvailable: true, CreatedAt: time.Now().Add(-48 * time.Hour)})
+	storage.PutPost(&model.Post{ID: "2", IsCommentingAvailable: true, CreatedAt: time.Now()})
+
+	repo := repository.NewMemoryPostRepo(storage, nil)
+
+	closed, err := repo.CloseCommentingOlderThan(context.Background(), 24*time.Hour)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1"}, closed)
+	assert.False(t, storage.Posts["1"].IsCommentingAvailable)
+	assert.True(t, storage.Posts["2"].IsCommentingAvailable)
+}
+
+func TestMemoryPosts_FirstOutOfRange(t *testing.T) {
+	repo := &repository.MemoryPostRepository{Storage: memory.NewStorage()}
+
+	for first, expected := range map[int]error{
+		-1:                         repository.ErrNegativeFirst,
+		repository.MaxPageSize + 1: repository.ErrFirstTooLarge,
+		2000000000:                 repository.ErrFirstTooLarge,
+	} {
+		_, err := repo.Posts(context.Background(), model.PostSortNew, nil, &first, nil)
+		assert.ErrorIs(t, err, expected, first)
+	}
+
+	first := repository.MaxPageSize
+	_, err := repo.Posts(context.Background(), model.PostSortNew, nil, &first, nil)
+	assert.NoError(t, err)
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"ozon-graphql-api/graph/model"
 	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/cursor"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -30,7 +31,7 @@ func TestCreatePost_Success(t *testing.T) {
 	}
 
 	rows := sqlmock.NewRows([]string{"id", "createdAt"}).
-		AddRow(1, "2024-09-09T12:34:56Z")
+		AddRow(1, ts("2024-09-09T12:34:56Z"))
 
 	mock.ExpectQuery("INSERT INTO posts").
 		WithArgs(input.Title, input.Text, input.UserID, input.IsCommentingAvailable).
@@ -43,7 +44,7 @@ func TestCreatePost_Success(t *testing.T) {
 	assert.Equal(t, "1", post.ID)
 	assert.Equal(t, input.Title, post.Title)
 	assert.Equal(t, input.Text, post.Text)
-	assert.Equal(t, "2024-09-09T12:34:56Z", post.CreatedAt)
+	assert.Equal(t, ts("2024-09-09T12:34:56Z"), post.CreatedAt)
 	assert.Equal(t, *input.IsCommentingAvailable, post.IsCommentingAvailable)
 	assert.Equal(t, input.UserID, post.CreatedBy.ID)
 
@@ -89,18 +90,17 @@ func TestPosts_Success(t *testing.T) {
 
 	repo := &repository.PostgresPostRepository{Db: sqlxDB}
 
-	limit := 10
-	offset := 0
+	first := 10
 
 	rows := sqlmock.NewRows([]string{"id", "title", "text", "createdat", "iscommentingavailable", "userid", "username"}).
-		AddRow(1, "Title1", "Text1", "2024-09-09T12:34:56Z", true, 123, "User1").
-		AddRow(2, "Title2", "Text2", "2024-09-08T12:34:56Z", false, 124, "User2")
+		AddRow(1, "Title1", "Text1", ts("2024-09-09T12:34:56Z"), true, 123, "User1").
+		AddRow(2, "Title2", "Text2", ts("2024-09-08T12:34:56Z"), false, 124, "User2")
 
 	mock.ExpectQuery("SELECT p.id, p.title, p.text, p.createdAt, p.isCommentingAvailable, u.id as userId, u.username").
-		WithArgs(limit, offset).
+		WithArgs(first + 1).
 		WillReturnRows(rows)
 
-	posts, err := repo.Posts(context.Background(), &limit, &offset)
+	connection, err := repo.Posts(context.Background(), model.PostSortNew, nil, &first, nil)
 
 	require.NoError(t, err)
 
@@ -109,7 +109,7 @@ func TestPosts_Success(t *testing.T) {
 			ID:                    "1",
 			Title:                 "Title1",
 			Text:                  "Text1",
-			CreatedAt:             "2024-09-09T12:34:56Z",
+			CreatedAt:             ts("2024-09-09T12:34:56Z"),
 			IsCommentingAvailable: true,
 			CreatedBy: &model.User{
 				ID:       "123",
@@ -120,7 +120,7 @@ func TestPosts_Success(t *testing.T) {
 			ID:                    "2",
 			Title:                 "Title2",
 			Text:                  "Text2",
-			CreatedAt:             "2024-09-08T12:34:56Z",
+			CreatedAt:             ts("2024-09-08T12:34:56Z"),
 			IsCommentingAvailable: false,
 			CreatedBy: &model.User{
 				ID:       "124",
@@ -129,7 +129,42 @@ func TestPosts_Success(t *testing.T) {
 		},
 	}
 
-	assert.ElementsMatch(t, expectedPosts, posts)
+	require.Len(t, connection.Edges, 2)
+	assert.Equal(t, expectedPosts[0], connection.Edges[0].Node)
+	assert.Equal(t, expectedPosts[1], connection.Edges[1].Node)
+	assert.False(t, connection.PageInfo.HasNextPage)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestPosts_AfterCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresPostRepository{Db: sqlxDB}
+
+	first := 1
+	after := cursor.Encode("2024-09-09T12:34:56Z", "5")
+
+	rows := sqlmock.NewRows([]string{"id", "title", "text", "createdat", "iscommentingavailable", "userid", "username"}).
+		AddRow(4, "Title4", "Text4", ts("2024-09-08T12:34:56Z"), true, 123, "User1").
+		AddRow(3, "Title3", "Text3", ts("2024-09-07T12:34:56Z"), true, 123, "User1")
+
+	mock.ExpectQuery(`WHERE \(p.createdAt, p.id\) < \(\$1, \$2\)`).
+		WithArgs(ts("2024-09-09T12:34:56Z"), 5, first+1).
+		WillReturnRows(rows)
+
+	connection, err := repo.Posts(context.Background(), model.PostSortNew, nil, &first, &after)
+
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, "4", connection.Edges[0].Node.ID)
+	assert.True(t, connection.PageInfo.HasNextPage)
+	assert.Equal(t, cursor.Encode("2024-09-08T12:34:56Z", "4"), *connection.PageInfo.EndCursor)
 
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
@@ -144,17 +179,223 @@ func TestPosts_Error(t *testing.T) {
 
 	repo := &repository.PostgresPostRepository{Db: sqlxDB}
 
-	limit := 10
-	offset := 0
+	first := 10
 
 	mock.ExpectQuery("SELECT p.id, p.title, p.text, p.createdAt, p.isCommentingAvailable, u.id as userId, u.username").
-		WithArgs(limit, offset).
+		WithArgs(first + 1).
 		WillReturnError(sql.ErrConnDone)
 
-	posts, err := repo.Posts(context.Background(), &limit, &offset)
+	connection, err := repo.Posts(context.Background(), model.PostSortNew, nil, &first, nil)
 
 	require.Error(t, err)
-	assert.Nil(t, posts)
+	assert.Nil(t, connection)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestDeletePost_WithoutComments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresPostRepository{Db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT createdBy, deletedAt FROM posts WHERE id = \$1 FOR UPDATE$`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"createdBy", "deletedAt"}).AddRow(1, nil))
+
+	mock.ExpectExec(`^DELETE FROM posts WHERE id = \$1 AND NOT EXISTS \(SELECT 1 FROM comments WHERE postId = \$1\)$`).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = repo.DeletePost(context.Background(), "3", "1")
+	require.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestUpdatePost_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresPostRepository{Db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT createdBy, deletedAt FROM posts WHERE id = \$1 FOR UPDATE$`).
+		WithArgs(3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	title := "New"
+	post, err := repo.UpdatePost(context.Background(), "3", "1", model.UpdatePost{Title: &title})
+
+	require.Error(t, err)
+	assert.Nil(t, post)
+	assert.Equal(t, "post not found", err.Error())
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestSetCommentingAvailable_Unchanged(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresPostRepository{Db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT createdBy, deletedAt FROM posts WHERE id = \$1 FOR UPDATE$`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"createdBy", "deletedAt"}).AddRow(1, nil))
+	mock.ExpectExec(`^UPDATE posts SET isCommentingAvailable = \$2 WHERE id = \$1 AND isCommentingAvailable <> \$2$`).
+		WithArgs(3, false).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery("SELECT p.id, p.title").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "text", "createdat", "iscommentingavailable", "userid", "username"}).
+			AddRow(3, "Title", "Text", ts("2024-09-09T12:34:56Z"), false, 1, "Maxim"))
+
+	post, err := repo.SetCommentingAvailable(context.Background(), "3", "1", false)
+
+	require.NoError(t, err)
+	assert.False(t, post.IsCommentingAvailable)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestSetCommentingAvailable_Notifies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresPostRepository{Db: sqlxDB}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT createdBy, deletedAt FROM posts WHERE id = \$1 FOR UPDATE$`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"createdBy", "deletedAt"}).AddRow(1, nil))
+	mock.ExpectExec(`^UPDATE posts SET isCommentingAvailable`).
+		WithArgs(3, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^SELECT pg_notify\(\$1, \$2\)$`).
+		WithArgs("comment_added", `{"type":"commentingAvailability","postId":"3","available":true}`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery("SELECT p.id, p.title").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "text", "createdat", "iscommentingavailable", "userid", "username"}).
+			AddRow(3, "Title", "Text", ts("2024-09-09T12:34:56Z"), true, 1, "Maxim"))
+
+	post, err := repo.SetCommentingAvailable(context.Background(), "3", "1", true)
+
+	require.NoError(t, err)
+	assert.True(t, post.IsCommentingAvailable)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestPosts_TopAfterCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &repository.PostgresPostRepository{Db: sqlx.NewDb(db, "postgres")}
+
+	first := 1
+	after := cursor.EncodeRanked("10", "2024-09-09T12:34:56Z", "5")
+
+	rows := sqlmock.NewRows([]string{"id", "title", "text", "createdat", "iscommentingavailable", "userid", "username", "upvotes", "downvotes", "rank"}).
+		AddRow(4, "Title4", "Text4", ts("2024-09-08T12:34:56Z"), true, 123, "User1", 8, 1, 7).
+		AddRow(3, "Title3", "Text3", ts("2024-09-10T12:34:56Z"), true, 123, "User1", 3, 0, 3)
+
+	mock.ExpectQuery(`WHERE \(\(p.upvotes - p.downvotes\), p.createdAt, p.id\) < \(\$1::integer, \$2, \$3\)\s+ORDER BY rank DESC, p.createdAt DESC, p.id DESC LIMIT \$4`).
+		WithArgs("10", ts("2024-09-09T12:34:56Z"), 5, first+1).
+		WillReturnRows(rows)
+
+	connection, err := repo.Posts(context.Background(), model.PostSortTop, nil, &first, &after)
+
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, 7, connection.Edges[0].Node.Score())
+	assert.Equal(t, cursor.EncodeRanked("7", "2024-09-08T12:34:56Z", "4"), *connection.PageInfo.EndCursor)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestPosts_TopCursorLargeScore: рейтинг TOP пишется в курсор целым числом без экспоненты,
+// иначе '1e+06'::integer в следующем запросе падает в базе.
+func TestPosts_TopCursorLargeScore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &repository.PostgresPostRepository{Db: sqlx.NewDb(db, "postgres")}
+
+	first := 1
+	rows := sqlmock.NewRows([]string{"id", "title", "text", "createdat", "iscommentingavailable", "userid", "username", "upvotes", "downvotes", "rank"}).
+		AddRow(4, "Title4", "Text4", ts("2024-09-08T12:34:56Z"), true, 123, "User1", 1234567, 0, 1234567)
+	mock.ExpectQuery(`ORDER BY rank DESC`).WithArgs(first + 1).WillReturnRows(rows)
+
+	connection, err := repo.Posts(context.Background(), model.PostSortTop, nil, &first, nil)
+	require.NoError(t, err)
+	endCursor := *connection.PageInfo.EndCursor
+	assert.Equal(t, cursor.EncodeRanked("1234567", "2024-09-08T12:34:56Z", "4"), endCursor)
+
+	mock.ExpectQuery(`< \(\$1::integer, \$2, \$3\)`).
+		WithArgs("1234567", ts("2024-09-08T12:34:56Z"), 4, first+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = repo.Posts(context.Background(), model.PostSortTop, nil, &first, &endCursor)
+	require.NoError(t, err)
+
+	//Дробный рейтинг в курсоре TOP отклоняется до запроса
+	for _, rank := range []string{"1.5", "1e+06"} {
+		after := cursor.EncodeRanked(rank, "2024-09-08T12:34:56Z", "4")
+		_, err = repo.Posts(context.Background(), model.PostSortTop, nil, &first, &after)
+		assert.ErrorIs(t, err, repository.ErrInvalidCursor, rank)
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetCommentingAvailable_TombstoneLockedInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresPostRepository{Db: sqlxDB}
+
+	//Проверка и запись идут в одной транзакции под FOR UPDATE: надгробие не открывается заново
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT createdBy, deletedAt FROM posts WHERE id = \$1 FOR UPDATE$`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"createdBy", "deletedAt"}).AddRow(1, "2024-09-09T12:34:56Z"))
+	mock.ExpectRollback()
+
+	post, err := repo.SetCommentingAvailable(context.Background(), "3", "1", true)
+
+	require.ErrorIs(t, err, repository.ErrPostDeleted)
+	assert.Nil(t, post)
 
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
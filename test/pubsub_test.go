@@ -0,0 +1,79 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-graphql-api/pkg/pubsub"
+	"testing"
+	"time"
+)
+
+func TestBroker_FanOut(t *testing.T) {
+	broker := pubsub.NewBroker[string](1, pubsub.DropMessage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := broker.Subscribe(ctx, "1")
+	second := broker.Subscribe(ctx, "1")
+	other := broker.Subscribe(ctx, "2")
+
+	broker.Publish("1", "hello")
+
+	assert.Equal(t, "hello", <-first)
+	assert.Equal(t, "hello", <-second)
+	assert.Empty(t, other)
+}
+
+func TestBroker_DropMessageKeepsSlowSubscriber(t *testing.T) {
+	broker := pubsub.NewBroker[string](1, pubsub.DropMessage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := broker.Subscribe(ctx, "1")
+
+	broker.Publish("1", "first")
+	broker.Publish("1", "second")
+
+	assert.Equal(t, "first", <-ch)
+	assert.Equal(t, 1, broker.Subscribers("1"))
+}
+
+func TestBroker_DisconnectSlowSubscriber(t *testing.T) {
+	broker := pubsub.NewBroker[string](1, pubsub.Disconnect)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := broker.Subscribe(ctx, "1")
+
+	broker.Publish("1", "first")
+	broker.Publish("1", "second")
+
+	assert.Equal(t, "first", <-ch)
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, 0, broker.Subscribers("1"))
+}
+
+func TestBroker_UnsubscribeOnCancel(t *testing.T) {
+	broker := pubsub.NewBroker[string](1, pubsub.DropMessage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := broker.Subscribe(ctx, "1")
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after context cancel")
+	}
+
+	assert.Equal(t, 0, broker.Subscribers("1"))
+
+	// публикация в топик без подписчиков не должна паниковать
+	broker.Publish("1", "late")
+}
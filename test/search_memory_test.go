@@ -0,0 +1,119 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/memory"
+	"path/filepath"
+	"testing"
+)
+
+func newSearchRepos(t *testing.T) (*memory.Storage, *repository.Repository) {
+	storage := memory.NewStorage()
+	repos := repository.NewMemoryRepository(storage)
+
+	ctx := context.Background()
+	_, err := repos.CreatePost(ctx, model.NewPost{Title: "Go generics", Text: "Generics in Go since 1.18", UserID: "1", IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+	_, err = repos.CreatePost(ctx, model.NewPost{Title: "Postgres", Text: "Full-text search in Postgres, not about go", UserID: "2", IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+	_, err = repos.CreateComment(ctx, model.NewComment{PostID: "1", SenderID: "3", Text: "Go generics are great"}, anyComment)
+	require.NoError(t, err)
+
+	return storage, repos
+}
+
+func searchIDs(connection *model.SearchConnection) []string {
+	var ids []string
+	for _, edge := range connection.Edges {
+		switch node := edge.Node.Node.(type) {
+		case *model.Post:
+			ids = append(ids, "post:"+node.ID)
+		case *model.Comment:
+			ids = append(ids, "comment:"+node.ID)
+		}
+	}
+	return ids
+}
+
+func TestMemorySearch_RanksTitleMatchesFirst(t *testing.T) {
+	_, repos := newSearchRepos(t)
+
+	connection, err := repos.Search(context.Background(), "GO generics", model.SearchTypeAll, nil, nil, nil)
+	require.NoError(t, err)
+
+	//Пост 2 не содержит слова generics, поэтому в выдачу не попадает
+	assert.Equal(t, []string{"post:1", "comment:1"}, searchIDs(connection))
+	assert.Equal(t, "<b>Go</b> <b>generics</b> <b>Generics</b> in <b>Go</b> since 1.18", connection.Edges[0].Node.Snippet)
+}
+
+func TestMemorySearch_Type(t *testing.T) {
+	_, repos := newSearchRepos(t)
+
+	connection, err := repos.Search(context.Background(), "go", model.SearchTypeComments, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"comment:1"}, searchIDs(connection))
+}
+
+func TestMemorySearch_EscapesSnippet(t *testing.T) {
+	_, repos := newSearchRepos(t)
+
+	_, err := repos.CreatePost(context.Background(), model.NewPost{Title: "XSS", Text: `<script>alert("go")</script> go & more`, UserID: "1", IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+
+	connection, err := repos.Search(context.Background(), "more", model.SearchTypePosts, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, "XSS &lt;script&gt;alert(&#34;go&#34;)&lt;/script&gt; go &amp; <b>more</b>", connection.Edges[0].Node.Snippet)
+}
+
+func TestMemorySearch_Pagination(t *testing.T) {
+	_, repos := newSearchRepos(t)
+
+	first := 1
+	var ids []string
+	var after *string
+	for {
+		page, err := repos.Search(context.Background(), "go", model.SearchTypeAll, nil, &first, after)
+		require.NoError(t, err)
+		ids = append(ids, searchIDs(page)...)
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		after = page.PageInfo.EndCursor
+	}
+
+	assert.Equal(t, []string{"post:1", "comment:1", "post:2"}, ids)
+}
+
+func TestMemorySearch_IndexFollowsEditsAndDeletes(t *testing.T) {
+	storage, repos := newSearchRepos(t)
+	ctx := context.Background()
+
+	_, err := repos.UpdateComment(ctx, "1", "3", "Rust traits")
+	require.NoError(t, err)
+
+	connection, err := repos.Search(ctx, "generics", model.SearchTypeComments, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, connection.Edges)
+
+	require.NoError(t, repos.DeletePost(ctx, "2", "2"))
+
+	connection, err = repos.Search(ctx, "postgres", model.SearchTypeAll, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, connection.Edges)
+
+	//Индекс не сохраняется в файл и после загрузки строится заново
+	snapshot := filepath.Join(t.TempDir(), "storage.json")
+	require.NoError(t, storage.SaveToFile(snapshot, 0))
+	restored, err := memory.LoadFromFile(snapshot, snapshot+".journal")
+	require.NoError(t, err)
+	repos = repository.NewMemoryRepository(restored)
+
+	connection, err = repos.Search(ctx, "rust", model.SearchTypeAll, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"comment:1"}, searchIDs(connection))
+}
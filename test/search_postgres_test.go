@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/cursor"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch_AfterCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresSearchRepo(sqlx.NewDb(db, "postgres"))
+
+	first := 1
+	after := cursor.EncodeRanked("0.6", "2024-09-09T12:34:56Z", "post:5")
+
+	rows := sqlmock.NewRows([]string{"kind", "id", "rank", "body", "createdat", "title", "text", "iscommentingavailable",
+		"postid", "replyto", "userid", "username", "editedat", "deletedat", "upvotes", "downvotes", "snippet"}).
+		AddRow(2, 7, 0.24, "go generics", ts("2024-09-08T12:34:56Z"), nil, "go generics", nil, 5, nil, 1, "Maxim", nil, nil, 0, 0, "\x02go\x03 generics").
+		AddRow(1, 3, 0.1, "Go", ts("2024-09-07T12:34:56Z"), "Go", "", true, nil, nil, 1, "Maxim", nil, nil, 0, 0, "\x02Go\x03")
+
+	mock.ExpectQuery(`plainto_tsquery\('simple', \$1\) q\s+WHERE p.searchVector @@ q AND p.deletedAt IS NULL UNION ALL SELECT 2 AS kind`).
+		WithArgs("go", "0.6", ts("2024-09-09T12:34:56Z"), 1, "5", first+1).
+		WillReturnRows(rows)
+
+	connection, err := repo.Search(context.Background(), "go", model.SearchTypeAll, nil, &first, &after)
+	require.NoError(t, err)
+
+	require.Len(t, connection.Edges, 1)
+	comment, ok := connection.Edges[0].Node.Node.(*model.Comment)
+	require.True(t, ok)
+	assert.Equal(t, "7", comment.ID)
+	assert.Equal(t, "5", comment.PostID)
+	assert.Equal(t, "<b>go</b> generics", connection.Edges[0].Node.Snippet)
+	assert.True(t, connection.PageInfo.HasNextPage)
+	assert.Equal(t, cursor.EncodeRanked("0.24", "2024-09-08T12:34:56Z", "comment:7"), *connection.PageInfo.EndCursor)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_PostsOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresSearchRepo(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectQuery(`FROM \(SELECT 1 AS kind, .* p.deletedAt IS NULL\) s\s+ORDER BY`).
+		WithArgs("go", 26).
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "id", "rank", "createdat", "text", "snippet"}))
+
+	connection, err := repo.Search(context.Background(), "go", model.SearchTypePosts, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, connection.Edges)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_EscapesSnippet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresSearchRepo(sqlx.NewDb(db, "postgres"))
+
+	//ts_headline отмечает совпадения маркерами, разметка из текста экранируется
+	rows := sqlmock.NewRows([]string{"kind", "id", "rank", "body", "createdat", "title", "text", "iscommentingavailable",
+		"postid", "replyto", "userid", "username", "editedat", "deletedat", "upvotes", "downvotes", "snippet"}).
+		AddRow(1, 3, 0.1, "x", ts("2024-09-07T12:34:56Z"), "x", "x", true, nil, nil, 1, "Maxim", nil, nil, 0, 0,
+			"<img src=x onerror=alert(1)> \x02go\x03 <b>")
+
+	mock.ExpectQuery(`ts_headline\('simple', s.body, plainto_tsquery\('simple', \$1\),\s+'StartSel=' \|\| chr\(2\) \|\| ', StopSel=' \|\| chr\(3\)\)`).
+		WithArgs("go", 26).
+		WillReturnRows(rows)
+
+	connection, err := repo.Search(context.Background(), "go", model.SearchTypePosts, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, "&lt;img src=x onerror=alert(1)&gt; <b>go</b> &lt;b&gt;", connection.Edges[0].Node.Snippet)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_NonNumericCursorID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresSearchRepo(sqlx.NewDb(db, "postgres"))
+
+	after := cursor.EncodeRanked("0.6", "2024-09-09T12:34:56Z", "post:abc")
+	_, err = repo.Search(context.Background(), "go", model.SearchTypeAll, nil, nil, &after)
+	require.ErrorIs(t, err, repository.ErrInvalidCursor)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,303 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/service"
+	"ozon-graphql-api/internal/validation"
+	"ozon-graphql-api/pkg/memory"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commentFixture описывает данные, с которыми правила создания комментария
+// прогоняются на обоих хранилищах: пост 1, пользователь 1 и комментарий 5.
+// В памяти стартовые пользователи есть всегда, поэтому отсутствующий отправитель - 42.
+type commentFixture struct {
+	postExists     bool
+	commentingOpen bool
+	senderExists   bool
+	// replyPostID - пост комментария 5, пустая строка - комментария нет
+	replyPostID string
+}
+
+func memoryCommentService(f commentFixture) *service.CommentService {
+	storage := memory.NewStorage()
+	author := storage.Users["1"]
+
+	if f.postExists {
+		storage.PutPost(&model.Post{ID: "1", CreatedBy: author, IsCommentingAvailable: f.commentingOpen})
+	}
+	if f.replyPostID != "" {
+		storage.PutComment(&model.Comment{ID: "5", PostID: f.replyPostID, Sender: author})
+	}
+
+	return service.NewCommentService(repository.NewMemoryRepository(storage), validation.New(validation.Config{}))
+}
+
+// postgresCommentService ожидает, что репозиторий прочитает пост, отправителя и родителя в транзакции
+// вставки, а после нарушенного правила откатит ее, ничего не вставив.
+func postgresCommentService(t *testing.T, f commentFixture, input model.NewComment) (*service.CommentService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	repos := &repository.Repository{
+		PostRepository:    repository.NewPostgresPostRepo(sqlxDB),
+		CommentRepository: repository.NewPostgresCommentRepo(sqlxDB),
+		UserRepository:    repository.NewPostgresUserRepo(sqlxDB),
+	}
+	commentService := service.NewCommentService(repos, validation.New(validation.Config{}))
+
+	mock.ExpectBegin()
+	postQuery := mock.ExpectQuery(`^SELECT isCommentingAvailable, deletedAt FROM posts WHERE id = \$1 FOR SHARE$`).WithArgs(1)
+	if f.postExists {
+		postQuery.WillReturnRows(sqlmock.NewRows([]string{"iscommentingavailable", "deletedat"}).AddRow(f.commentingOpen, nil))
+	} else {
+		postQuery.WillReturnError(sql.ErrNoRows)
+	}
+
+	senderID, _ := strconv.Atoi(input.SenderID)
+	senderQuery := mock.ExpectQuery(`^SELECT username FROM users WHERE id = \$1$`).WithArgs(senderID)
+	if f.senderExists {
+		senderQuery.WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("Maxim"))
+	} else {
+		senderQuery.WillReturnError(sql.ErrNoRows)
+	}
+
+	if input.ReplyTo != nil {
+		parentQuery := mock.ExpectQuery(`^SELECT postid FROM comments WHERE id = \$1 FOR SHARE$`).WithArgs(5)
+		if f.replyPostID == "" {
+			parentQuery.WillReturnError(sql.ErrNoRows)
+		} else {
+			parentPostID, _ := strconv.Atoi(f.replyPostID)
+			parentQuery.WillReturnRows(sqlmock.NewRows([]string{"postid"}).AddRow(parentPostID))
+		}
+	}
+
+	allowed := f.postExists && f.commentingOpen && f.senderExists && (input.ReplyTo == nil || f.replyPostID == "1")
+	if !allowed {
+		mock.ExpectRollback()
+		return commentService, mock
+	}
+
+	mock.ExpectQuery(`^INSERT INTO comments`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "createdAt"}).AddRow(9, ts("2024-09-09T12:34:56Z")))
+	mock.ExpectExec(`^SELECT pg_notify`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	return commentService, mock
+}
+
+func TestCommentService_CreateCommentRules(t *testing.T) {
+	open := commentFixture{postExists: true, commentingOpen: true, senderExists: true}
+	reply := "5"
+
+	tests := []struct {
+		name    string
+		fixture commentFixture
+		input   model.NewComment
+		err     error
+	}{
+		{
+			name:    "root comment",
+			fixture: open,
+			input:   model.NewComment{PostID: "1", SenderID: "1", Text: "Hello"},
+		},
+		{
+			name:    "reply in the same post",
+			fixture: commentFixture{postExists: true, commentingOpen: true, senderExists: true, replyPostID: "1"},
+			input:   model.NewComment{PostID: "1", SenderID: "1", ReplyTo: &reply, Text: "Hello"},
+		},
+		{
+			name:    "post not found",
+			fixture: commentFixture{senderExists: true},
+			input:   model.NewComment{PostID: "1", SenderID: "1", Text: "Hello"},
+			err:     repository.ErrPostNotFound,
+		},
+		{
+			name:    "commenting closed",
+			fixture: commentFixture{postExists: true, senderExists: true},
+			input:   model.NewComment{PostID: "1", SenderID: "1", Text: "Hello"},
+			err:     repository.ErrCommentingClosed,
+		},
+		{
+			name:    "sender not found",
+			fixture: commentFixture{postExists: true, commentingOpen: true},
+			input:   model.NewComment{PostID: "1", SenderID: "42", Text: "Hello"},
+			err:     repository.ErrUserNotFound,
+		},
+		{
+			name:    "reply not found",
+			fixture: open,
+			input:   model.NewComment{PostID: "1", SenderID: "1", ReplyTo: &reply, Text: "Hello"},
+			err:     repository.ErrReplyToNotFound,
+		},
+		{
+			name:    "reply to another post",
+			fixture: commentFixture{postExists: true, commentingOpen: true, senderExists: true, replyPostID: "2"},
+			input:   model.NewComment{PostID: "1", SenderID: "1", ReplyTo: &reply, Text: "Hello"},
+			err:     service.ErrReplyToOtherPost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/memory", func(t *testing.T) {
+			comment, err := memoryCommentService(tt.fixture).CreateComment(context.Background(), tt.input)
+			assertCreated(t, tt.err, comment, err)
+		})
+
+		t.Run(tt.name+"/postgres", func(t *testing.T) {
+			commentService, mock := postgresCommentService(t, tt.fixture, tt.input)
+			comment, err := commentService.CreateComment(context.Background(), tt.input)
+			assertCreated(t, tt.err, comment, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func assertCreated(t *testing.T, expected error, comment *model.Comment, err error) {
+	if expected == nil {
+		require.NoError(t, err)
+		require.NotNil(t, comment)
+		return
+	}
+	assert.Nil(t, comment)
+	assert.ErrorIs(t, err, expected)
+}
+
+func TestCommentService_ValidatesBeforeStorage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repos := repository.NewPostgresRepository(sqlx.NewDb(db, "postgres"), nil)
+	commentService := service.NewCommentService(repos, validation.New(validation.Config{MaxCommentLength: 3}))
+
+	_, err = commentService.CreateComment(context.Background(), model.NewComment{PostID: "1", SenderID: "1", Text: "Hello"})
+
+	require.ErrorIs(t, err, apperr.Validation)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostService_CreatePostRequiresAuthor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT id, username FROM users WHERE id = \$1$`).
+		WithArgs(42).
+		WillReturnError(sql.ErrNoRows)
+
+	backends := map[string]*repository.Repository{
+		"memory":   repository.NewMemoryRepository(memory.NewStorage()),
+		"postgres": repository.NewPostgresRepository(sqlx.NewDb(db, "postgres"), nil),
+	}
+
+	for name, repos := range backends {
+		t.Run(name, func(t *testing.T) {
+			postService := service.NewPostService(repos, validation.New(validation.Config{}))
+
+			post, err := postService.CreatePost(context.Background(), model.NewPost{Title: "Title", Text: "Text", UserID: "42"})
+
+			assert.Nil(t, post)
+			assert.ErrorIs(t, err, repository.ErrUserNotFound)
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostService_CreatePostDefaultsCommenting(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.Users["1"] = &model.User{ID: "1", Username: "Maxim"}
+	postService := service.NewPostService(repository.NewMemoryRepository(storage), validation.New(validation.Config{}))
+
+	post, err := postService.CreatePost(context.Background(), model.NewPost{Title: "Title", Text: "Text", UserID: "1"})
+
+	require.NoError(t, err)
+	assert.True(t, post.IsCommentingAvailable)
+	assert.Equal(t, "Maxim", post.CreatedBy.Username)
+}
+
+func TestPostgresCreatePost_NilCommentingDefaultsToOpen(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &repository.PostgresPostRepository{Db: sqlx.NewDb(db, "postgres")}
+
+	mock.ExpectQuery(`^INSERT INTO posts`).
+		WithArgs("Title", "Text", "1", true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "createdAt"}).AddRow(1, ts("2024-09-09T12:34:56Z")))
+
+	post, err := repo.CreatePost(context.Background(), model.NewPost{Title: "Title", Text: "Text", UserID: "1"})
+
+	require.NoError(t, err)
+	assert.True(t, post.IsCommentingAvailable)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_CreateUserValidatesOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`^INSERT INTO users`).
+		WithArgs("Anna").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+	backends := map[string]*repository.Repository{
+		"memory":   repository.NewMemoryRepository(memory.NewStorage()),
+		"postgres": repository.NewPostgresRepository(sqlx.NewDb(db, "postgres"), nil),
+	}
+
+	for name, repos := range backends {
+		t.Run(name, func(t *testing.T) {
+			userService := service.NewUserService(repos, validation.New(validation.Config{}))
+
+			_, err := userService.CreateUser(context.Background(), model.NewUser{Username: "   "})
+			assert.ErrorIs(t, err, apperr.Validation)
+
+			//Имя сохраняется без пробелов по краям
+			user, err := userService.CreateUser(context.Background(), model.NewUser{Username: " Anna "})
+			require.NoError(t, err)
+			assert.Equal(t, "Anna", user.Username)
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVoteService_ValidatesValue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	backends := map[string]*repository.Repository{
+		"memory":   repository.NewMemoryRepository(newVoteStorage()),
+		"postgres": repository.NewPostgresRepository(sqlx.NewDb(db, "postgres"), nil),
+	}
+
+	for name, repos := range backends {
+		t.Run(name, func(t *testing.T) {
+			voteService := service.NewVoteService(repos, validation.New(validation.Config{}))
+
+			_, err := voteService.Vote(context.Background(), model.VoteTargetPost, "1", "1", 2)
+
+			require.ErrorIs(t, err, apperr.Validation)
+			assert.Equal(t, "value", apperr.FieldsOf(err)[0].Field)
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,189 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/memory"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func snapshotStorage(username string) *memory.Storage {
+	storage := memory.NewStorage()
+	storage.Users["4"] = &model.User{ID: "4", Username: username}
+	storage.UserIdCounter = 4
+	storage.PutPost(&model.Post{ID: "1", Title: "Title", Text: "Text", CreatedBy: storage.Users["4"], CreatedAt: ts("2024-09-09T12:34:56.123Z"), IsCommentingAvailable: true})
+	storage.PostIdCounter = 1
+	return storage
+}
+
+func TestMemorySnapshot_VersionAndChecksum(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+
+	require.NoError(t, snapshotStorage("Saved").SaveToFile(filename, 0))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	var header struct {
+		Version  int    `json:"version"`
+		Checksum string `json:"checksum"`
+	}
+	require.NoError(t, json.Unmarshal(data, &header))
+	assert.Equal(t, memory.SnapshotVersion, header.Version)
+	assert.True(t, strings.HasPrefix(header.Checksum, "sha256:"))
+
+	restored, err := memory.LoadFromFile(filename, filepath.Join(t.TempDir(), "storage.journal"))
+	require.NoError(t, err)
+	assert.Equal(t, "Saved", restored.Users["4"].Username)
+	assert.Equal(t, ts("2024-09-09T12:34:56.123Z"), restored.Posts["1"].CreatedAt)
+	assert.Equal(t, 1, restored.PostIdCounter)
+
+	//Временные файлы после записи не остаются
+	files, err := filepath.Glob(filename + ".*.tmp")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestMemorySnapshot_CorruptFileFailsLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	journal := filepath.Join(t.TempDir(), "storage.journal")
+	require.NoError(t, snapshotStorage("Saved").SaveToFile(filename, 0))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	//Данные изменены, но JSON остался валидным - ловит только контрольная сумма
+	require.NoError(t, os.WriteFile(filename, []byte(strings.Replace(string(data), "Saved", "Evil!", 1)), 0644))
+	_, err = memory.LoadFromFile(filename, journal)
+	assert.ErrorIs(t, err, memory.ErrSnapshotChecksum)
+
+	//Недописанный файл
+	require.NoError(t, os.WriteFile(filename, data[:len(data)/2], 0644))
+	_, err = memory.LoadFromFile(filename, journal)
+	assert.Error(t, err)
+}
+
+func TestMemorySnapshot_NewerVersionFailsLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{"version": 99, "checksum": "sha256:", "data": {}}`), 0644))
+
+	_, err := memory.LoadFromFile(filename, filepath.Join(t.TempDir(), "storage.journal"))
+	assert.ErrorContains(t, err, "version 99")
+}
+
+func TestMemorySnapshot_MigratesLegacyFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	//Снимок до появления версий: без конверта, с мьютексом и пустыми строками вместо времени у заглушек
+	legacy := `{"Mu":{},"Posts":{"1":{"id":"1","title":"T","text":"T","createdBy":{"id":"1","username":"Maxim"},"createdAt":"2024-09-09T23:21:33+03:00","isCommentingAvailable":true}},
+		"Comments":{"2":{"id":"2","postId":"1","sender":{"id":"1","username":"Maxim"},"text":"Hi","createdAt":"2024-09-09T23:22:11+03:00"},
+		"3":{"id":"3","postId":"1","sender":{"id":"1","username":"Maxim"},"replyTo":{"id":"2","postId":"","sender":null,"text":"","createdAt":""},"text":"Re","createdAt":"2024-09-09T23:23:17+03:00"}},
+		"Users":{"1":{"id":"1","username":"Maxim"}},"PostIdCounter":1,"CommentIdCounter":3,"UserIdCounter":3}`
+	require.NoError(t, os.WriteFile(filename, []byte(legacy), 0644))
+
+	restored, err := memory.LoadFromFile(filename, filepath.Join(t.TempDir(), "storage.journal"))
+	require.NoError(t, err)
+
+	assert.Equal(t, ts("2024-09-09T20:22:11Z"), restored.Comments["2"].CreatedAt.UTC())
+	//Заглушка родителя заменена самим комментарием
+	assert.Same(t, restored.Comments["2"], restored.Comments["3"].ReplyTo)
+	assert.Equal(t, []*model.Comment{restored.Comments["3"]}, restored.Comments["2"].Replies)
+	assert.Same(t, restored.Users["1"], restored.Posts["1"].CreatedBy)
+	assert.Equal(t, 3, restored.CommentIdCounter)
+	assert.NotNil(t, restored.Votes)
+}
+
+func TestMemorySnapshot_LoadsCheckedInLegacyFile(t *testing.T) {
+	//Копия, чтобы загрузка не обрезала журнал рядом с настоящим файлом
+	data, err := os.ReadFile("../storage.json")
+	require.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	require.NoError(t, os.WriteFile(filename, data, 0644))
+
+	restored, err := memory.LoadFromFile(filename, filepath.Join(t.TempDir(), "storage.journal"))
+	require.NoError(t, err)
+
+	for id, comment := range restored.Comments {
+		assert.False(t, comment.CreatedAt.IsZero(), "comment %s", id)
+		if comment.ReplyTo != nil {
+			assert.Same(t, restored.Comments[comment.ReplyTo.ID], comment.ReplyTo, "comment %s", id)
+		}
+	}
+	assert.Same(t, restored.Comments["3"], restored.Comments["4"].ReplyTo)
+}
+
+func TestMemorySnapshot_RotatesPreviousSnapshots(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	journal := filepath.Join(t.TempDir(), "storage.journal")
+
+	for _, username := range []string{"First", "Second", "Third", "Fourth"} {
+		require.NoError(t, snapshotStorage(username).SaveToFile(filename, 2))
+	}
+
+	for name, username := range map[string]string{filename: "Fourth", filename + ".1": "Third", filename + ".2": "Second"} {
+		restored, err := memory.LoadFromFile(name, journal)
+		require.NoError(t, err)
+		assert.Equal(t, username, restored.Users["4"].Username, name)
+	}
+
+	_, err := os.Stat(filename + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMemorySnapshot_RoundTripKeepsCommentTree(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	journal := filepath.Join(t.TempDir(), "storage.journal")
+	ctx := context.Background()
+
+	storage := memory.NewStorage()
+	repos := repository.NewMemoryRepository(storage)
+	post, err := repos.CreatePost(ctx, model.NewPost{Title: "Title", Text: "Text", UserID: "1", IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+	root, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "2", Text: "Root"}, anyComment)
+	require.NoError(t, err)
+	reply, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "3", ReplyTo: &root.ID, Text: "Reply"}, anyComment)
+	require.NoError(t, err)
+	_, err = repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "1", ReplyTo: &reply.ID, Text: "Leaf"}, anyComment)
+	require.NoError(t, err)
+	_, err = repos.Vote(ctx, model.VoteTargetComment, reply.ID, "1", 1)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.SaveToFile(filename, 0))
+	restored, err := memory.LoadFromFile(filename, journal)
+	require.NoError(t, err)
+
+	assertSameStorage(t, storage, restored)
+
+	//Ссылки указывают на записи из карт хранилища, а не на их копии
+	comments := restored.Comments
+	assert.Same(t, restored.Users["1"], restored.Posts["1"].CreatedBy)
+	assert.Same(t, restored.Users["3"], comments["2"].Sender)
+	assert.Same(t, comments["1"], comments["2"].ReplyTo)
+	assert.Same(t, comments["2"], comments["3"].ReplyTo)
+	require.Len(t, comments["1"].Replies, 1)
+	assert.Same(t, comments["2"], comments["1"].Replies[0])
+	require.Len(t, comments["2"].Replies, 1)
+	assert.Same(t, comments["3"], comments["2"].Replies[0])
+
+	//Новые ответы после загрузки видны в дереве, а id продолжают счетчики
+	next, err := repository.NewMemoryRepository(restored).CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "2", ReplyTo: &reply.ID, Text: "Next"}, anyComment)
+	require.NoError(t, err)
+	assert.Equal(t, "4", next.ID)
+	assert.Equal(t, []*model.Comment{comments["3"], comments["4"]}, comments["2"].Replies)
+	assert.Same(t, comments["2"], comments["1"].Replies[0])
+
+	//Снимок детерминирован: повторное сохранение без изменений дает тот же файл
+	saved, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NoError(t, storage.SaveToFile(filename, 0))
+	again, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, saved, again)
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/cursor"
+	"ozon-graphql-api/pkg/memory"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newSortStorage() *memory.Storage {
+	storage := memory.NewStorage()
+
+	author := &model.User{ID: "1", Username: "Maxim"}
+	posts := []*model.Post{
+		{ID: "1", CreatedAt: ts("2024-09-10T10:00:00Z"), Upvotes: 10, Downvotes: 0},
+		{ID: "2", CreatedAt: ts("2024-09-10T11:00:00Z"), Upvotes: 6, Downvotes: 5},
+		{ID: "3", CreatedAt: ts("2024-09-11T10:00:00Z"), Upvotes: 2, Downvotes: 0},
+		{ID: "4", CreatedAt: ts("2024-09-10T12:00:00Z"), Upvotes: 0, Downvotes: 3},
+	}
+	for _, post := range posts {
+		post.CreatedBy = author
+		storage.PutPost(post)
+	}
+
+	return storage
+}
+
+func postIDs(connection *model.PostConnection) []string {
+	var ids []string
+	for _, edge := range connection.Edges {
+		ids = append(ids, edge.Node.ID)
+	}
+	return ids
+}
+
+func TestMemoryPosts_SortModes(t *testing.T) {
+	repo := &repository.MemoryPostRepository{Storage: newSortStorage()}
+
+	tests := []struct {
+		sort     model.PostSort
+		expected []string
+	}{
+		{model.PostSortNew, []string{"3", "4", "2", "1"}},
+		{model.PostSortOld, []string{"1", "2", "4", "3"}},
+		{model.PostSortTop, []string{"1", "3", "2", "4"}},
+		//Пост с рейтингом 2 обгоняет пост суточной давности с рейтингом 10
+		{model.PostSortHot, []string{"3", "1", "2", "4"}},
+		//Посты без голосов против идут после спорных в хронологическом порядке
+		{model.PostSortControversial, []string{"2", "3", "4", "1"}},
+	}
+
+	for _, tt := range tests {
+		connection, err := repo.Posts(context.Background(), tt.sort, nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, postIDs(connection), tt.sort)
+	}
+}
+
+func TestMemoryPosts_TopPagination(t *testing.T) {
+	storage := newSortStorage()
+	repo := &repository.MemoryPostRepository{Storage: storage}
+
+	first := 2
+	page, err := repo.Posts(context.Background(), model.PostSortTop, nil, &first, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "3"}, postIDs(page))
+	require.True(t, page.PageInfo.HasNextPage)
+
+	//Новый пост выше курсора по рейтингу не сдвигает следующую страницу
+	storage.PutPost(&model.Post{ID: "5", CreatedAt: ts("2024-09-14T10:00:00Z"), Upvotes: 7, CreatedBy: storage.Posts["1"].CreatedBy})
+
+	page, err = repo.Posts(context.Background(), model.PostSortTop, nil, &first, page.PageInfo.EndCursor)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "4"}, postIDs(page))
+	assert.False(t, page.PageInfo.HasNextPage)
+}
+
+// Страница по рейтингу собирается из лучших записей после курсора, а не из отсортированной ленты:
+// постраничный обход должен совпасть с лентой целиком.
+func TestMemoryPosts_RankedPagesMatchFullFeed(t *testing.T) {
+	storage := memory.NewStorage()
+	author := &model.User{ID: "1", Username: "Maxim"}
+	for i := 1; i <= 40; i++ {
+		storage.PutPost(&model.Post{ID: strconv.Itoa(i), CreatedBy: author,
+			CreatedAt: ts("2024-09-10T10:00:00Z").Add(time.Duration(i*37%40) * time.Hour),
+			Upvotes:   i * 7 % 11, Downvotes: i * 5 % 7})
+	}
+	repo := &repository.MemoryPostRepository{Storage: storage}
+
+	for _, sort := range []model.PostSort{model.PostSortTop, model.PostSortHot, model.PostSortControversial} {
+		all := 100
+		full, err := repo.Posts(context.Background(), sort, nil, &all, nil)
+		require.NoError(t, err)
+		require.Len(t, full.Edges, 40)
+
+		var paged []string
+		first := 3
+		var after *string
+		for {
+			page, err := repo.Posts(context.Background(), sort, nil, &first, after)
+			require.NoError(t, err)
+			paged = append(paged, postIDs(page)...)
+			if !page.PageInfo.HasNextPage {
+				break
+			}
+			after = page.PageInfo.EndCursor
+		}
+
+		assert.Equal(t, postIDs(full), paged, sort)
+	}
+}
+
+func TestMemoryPosts_ChronologicalCursorRejectedForRankedSort(t *testing.T) {
+	repo := &repository.MemoryPostRepository{Storage: newSortStorage()}
+
+	after := cursor.Encode("2024-09-12T10:00:00Z", "3")
+	_, err := repo.Posts(context.Background(), model.PostSortHot, nil, nil, &after)
+
+	require.ErrorIs(t, err, cursor.ErrInvalidCursor)
+}
+
+func TestMemoryCommentsByPost_Top(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.PutComment(&model.Comment{ID: "1", PostID: "1", CreatedAt: ts("2024-09-10T10:00:00Z"), Upvotes: 1})
+	storage.PutComment(&model.Comment{ID: "2", PostID: "1", CreatedAt: ts("2024-09-11T10:00:00Z"), Upvotes: 5})
+	storage.PutComment(&model.Comment{ID: "3", PostID: "1", CreatedAt: ts("2024-09-12T10:00:00Z"), Upvotes: 1})
+
+	repo := &repository.MemoryCommentRepository{Storage: storage}
+
+	connection, err := repo.CommentsByPost(context.Background(), "1", model.CommentSortTop, nil, nil)
+	require.NoError(t, err)
+
+	//При равном рейтинге выше стоит более новый комментарий
+	var ids []string
+	for _, comment := range commentNodes(connection) {
+		ids = append(ids, comment.ID)
+	}
+	assert.Equal(t, []string{"2", "3", "1"}, ids)
+}
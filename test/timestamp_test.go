@@ -0,0 +1,122 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/cursor"
+	"ozon-graphql-api/pkg/memory"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ts разбирает время в тестовых данных
+func ts(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		panic(err)
+	}
+	return t.UTC()
+}
+
+func TestMarshalTimestamp_UTCNano(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	value := time.Date(2024, 9, 9, 15, 34, 56, 120000000, moscow)
+
+	var buf bytes.Buffer
+	model.MarshalTimestamp(value).MarshalGQL(&buf)
+
+	assert.Equal(t, `"2024-09-09T12:34:56.12Z"`, buf.String())
+}
+
+func TestUnmarshalTimestamp(t *testing.T) {
+	value, err := model.UnmarshalTimestamp("2024-09-09T15:34:56+03:00")
+	require.NoError(t, err)
+	assert.Equal(t, ts("2024-09-09T12:34:56Z"), value)
+	assert.Equal(t, time.UTC, value.Location())
+
+	_, err = model.UnmarshalTimestamp("09.09.2024")
+	assert.ErrorIs(t, err, apperr.Validation)
+
+	_, err = model.UnmarshalTimestamp(1725885296)
+	assert.ErrorIs(t, err, apperr.Validation)
+}
+
+func TestTimestampArgument_InvalidFormat(t *testing.T) {
+	repos := repository.NewMemoryRepository(memory.NewStorage())
+
+	response := doPresentedQuery(t, repos, `{ posts(createdAt: {from: "yesterday"}) { edges { node { id } } } }`)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, string(apperr.Validation), response.Errors[0].Extensions["code"])
+}
+
+func TestDateRange_FromAfterTo(t *testing.T) {
+	repos := repository.NewMemoryRepository(memory.NewStorage())
+
+	response := doPresentedQuery(t, repos, `{ comments(createdAt: {from: "2024-09-10T00:00:00Z", to: "2024-09-09T00:00:00Z"}) { edges { node { id } } } }`)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, string(apperr.Validation), response.Errors[0].Extensions["code"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"field": "createdAt", "rule": "date_range", "message": "from should be earlier than to"},
+	}, response.Errors[0].Extensions["fields"])
+}
+
+func TestMemoryPosts_CreatedAtRange(t *testing.T) {
+	storage := memory.NewStorage()
+	storage.PutPost(&model.Post{ID: "1", CreatedAt: ts("2024-09-08T23:59:59.999Z")})
+	storage.PutPost(&model.Post{ID: "2", CreatedAt: ts("2024-09-09T00:00:00Z")})
+	storage.PutPost(&model.Post{ID: "3", CreatedAt: ts("2024-09-09T12:00:00Z")})
+	storage.PutPost(&model.Post{ID: "4", CreatedAt: ts("2024-09-10T00:00:00Z")})
+
+	repo := repository.NewMemoryPostRepo(storage, nil)
+
+	from, to := ts("2024-09-09T00:00:00Z"), ts("2024-09-10T00:00:00Z")
+	connection, err := repo.Posts(context.Background(), model.PostSortNew, &model.DateRange{From: &from, To: &to}, nil, nil)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, edge := range connection.Edges {
+		ids = append(ids, edge.Node.ID)
+	}
+	assert.Equal(t, []string{"3", "2"}, ids)
+
+	connection, err = repo.Posts(context.Background(), model.PostSortNew, &model.DateRange{From: &to}, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, "4", connection.Edges[0].Node.ID)
+}
+
+func TestPostgresComments_CreatedAtRange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresCommentRepo(sqlx.NewDb(db, "postgres"))
+
+	from, to := ts("2024-09-09T00:00:00Z"), ts("2024-09-10T00:00:00Z")
+	after := "2024-09-09T18:00:00Z"
+
+	rows := sqlmock.NewRows([]string{"id", "postid", "sender", "replyto", "text", "createdat", "username"}).
+		AddRow(3, 101, 1, nil, "Comment", ts("2024-09-09T12:00:00Z"), "user1")
+
+	mock.ExpectQuery(`WHERE c\.createdAt >= \$1 AND c\.createdAt < \$2 AND \(c\.createdAt, c\.id\) < \(\$3, \$4\)`).
+		WithArgs(from, to, ts(after), 5, 26).
+		WillReturnRows(rows)
+
+	cursorAfter := cursor.Encode(after, "5")
+	connection, err := repo.Comments(context.Background(), model.CommentSortNew, &model.DateRange{From: &from, To: &to}, nil, &cursorAfter)
+	require.NoError(t, err)
+
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, ts("2024-09-09T12:00:00Z"), connection.Edges[0].Node.CreatedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
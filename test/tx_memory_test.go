@@ -0,0 +1,137 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/service"
+	"ozon-graphql-api/internal/validation"
+	"ozon-graphql-api/pkg/memory"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryUpdate_ErrorSkipsJournal(t *testing.T) {
+	dir := t.TempDir()
+	storage := journaledStorage(t, dir, 0)
+
+	failed := errors.New("failed")
+	err := storage.Update(func(tx *memory.Tx) error {
+		tx.Record(memory.UserSaved(&model.User{ID: "10", Username: "Lost"}))
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	require.NoError(t, storage.Update(func(tx *memory.Tx) error {
+		tx.Users["4"] = &model.User{ID: "4", Username: "Saved"}
+		tx.Record(memory.UserSaved(tx.Users["4"]))
+		return nil
+	}))
+	require.NoError(t, storage.Journal.Close())
+
+	restored, err := memory.LoadFromFile(filepath.Join(dir, "storage.json"), filepath.Join(dir, "storage.journal"))
+	require.NoError(t, err)
+	assert.Contains(t, restored.Users, "4")
+	assert.NotContains(t, restored.Users, "10")
+}
+
+// TestMemoryRepository_ConcurrentMutations гоняет мутации и чтения параллельно. Запускать с -race:
+// резолверы читают ответы без блокировки, пока соседние мутации меняют те же записи.
+func TestMemoryRepository_ConcurrentMutations(t *testing.T) {
+	const (
+		workers = 8
+		rounds  = 50
+	)
+
+	storage := memory.NewStorage()
+	repos := repository.NewMemoryRepository(storage)
+	//Правила создания проверяет сервис внутри транзакции вставки
+	comments := service.NewCommentService(repos, validation.New(validation.Config{}))
+	ctx := context.Background()
+
+	post, err := repos.CreatePost(ctx, model.NewPost{Title: "Title", Text: "Text", UserID: "1", IsCommentingAvailable: boolPtr(true)})
+	require.NoError(t, err)
+	root, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "1", Text: "Root"}, anyComment)
+	require.NoError(t, err)
+
+	var created atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			sender := strconv.Itoa(w%3 + 1)
+
+			for i := 0; i < rounds; i++ {
+				reply, err := comments.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: sender, ReplyTo: &root.ID, Text: "Reply"})
+				if !assert.NoError(t, err) {
+					return
+				}
+				created.Add(1)
+
+				_, err = repos.Vote(ctx, model.VoteTargetComment, root.ID, sender, 1-2*(i%2))
+				assert.NoError(t, err)
+				_, err = repos.Vote(ctx, model.VoteTargetPost, post.ID, sender, 1)
+				assert.NoError(t, err)
+
+				_, err = repos.UpdateComment(ctx, reply.ID, sender, "Edited")
+				assert.NoError(t, err)
+
+				//Ответ на комментарий соседнего потока соревнуется с его удалением
+				n, _ := strconv.Atoi(reply.ID)
+				neighbour := strconv.Itoa(n - 1)
+				_, err = comments.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "1", ReplyTo: &neighbour, Text: "Leaf"})
+				if err != nil {
+					assert.ErrorIs(t, err, repository.ErrReplyToNotFound)
+				} else {
+					created.Add(1)
+				}
+				assert.NoError(t, repos.DeleteComment(ctx, reply.ID, sender))
+
+				page, err := repos.CommentsByPost(ctx, post.ID, model.CommentSortTop, nil, nil)
+				if assert.NoError(t, err) {
+					for _, edge := range page.Edges {
+						_ = edge.Node.Text + strconv.Itoa(edge.Node.Upvotes)
+					}
+				}
+				replies, err := repos.RepliesByComment(ctx, root.ID, model.CommentSortNew, nil, nil)
+				if assert.NoError(t, err) {
+					for _, edge := range replies.Edges {
+						_ = edge.Node.Text
+						_ = edge.Node.DeletedAt
+					}
+				}
+				found, err := repos.PostByID(ctx, 1)
+				if assert.NoError(t, err) {
+					_ = found.Upvotes
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	//Счетчик выдал по id на каждую вставку, индексы и дерево совпадают с картой
+	assert.Equal(t, int(created.Load())+1, storage.CommentIdCounter)
+	assert.Equal(t, len(storage.Comments), storage.CommentsByTime().Len())
+	for id, comment := range storage.Comments {
+		if comment.ReplyTo == nil {
+			continue
+		}
+		parent, ok := storage.Comments[comment.ReplyTo.ID]
+		require.True(t, ok, "reply %s lost its parent", id)
+		assert.Same(t, parent, comment.ReplyTo)
+		assert.Contains(t, parent.Replies, comment)
+	}
+
+	for id, comment := range storage.Comments {
+		assert.Equal(t, len(comment.Replies), storage.RepliesTo(id).Len(), id)
+	}
+	assert.Equal(t, 3, storage.Posts[post.ID].Upvotes)
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/memory"
+	"testing"
+)
+
+func TestMemoryCreateUser_Success(t *testing.T) {
+	storage := memory.NewStorage()
+
+	repo := repository.NewMemoryUserRepo(storage)
+
+	user, err := repo.CreateUser(context.Background(), model.NewUser{Username: "Anna"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "4", user.ID)
+	assert.Equal(t, "Anna", user.Username)
+	assert.Equal(t, user, storage.Users["4"])
+
+	found, err := repo.UserByUsername(context.Background(), "anna")
+	require.NoError(t, err)
+	assert.Equal(t, user, found)
+}
+
+func TestMemoryCreateUser_UsernameTaken(t *testing.T) {
+	storage := memory.NewStorage()
+
+	repo := repository.NewMemoryUserRepo(storage)
+
+	user, err := repo.CreateUser(context.Background(), model.NewUser{Username: "maxim"})
+
+	require.Error(t, err)
+	assert.Nil(t, user)
+	assert.Equal(t, "username already taken", err.Error())
+}
+
+func TestMemoryUsers_Pagination(t *testing.T) {
+	repo := repository.NewMemoryUserRepo(memory.NewStorage())
+
+	first := 2
+	page, err := repo.Users(context.Background(), &first, nil)
+	require.NoError(t, err)
+	require.Len(t, page.Edges, 2)
+	assert.Equal(t, "Maxim", page.Edges[0].Node.Username)
+	assert.Equal(t, "Vika", page.Edges[1].Node.Username)
+	assert.True(t, page.PageInfo.HasNextPage)
+
+	page, err = repo.Users(context.Background(), &first, page.PageInfo.EndCursor)
+	require.NoError(t, err)
+	require.Len(t, page.Edges, 1)
+	assert.Equal(t, "Ruslan", page.Edges[0].Node.Username)
+	assert.False(t, page.PageInfo.HasNextPage)
+}
+
+func TestMemoryUserByID_NotFound(t *testing.T) {
+	repo := repository.NewMemoryUserRepo(memory.NewStorage())
+
+	user, err := repo.UserByID(context.Background(), "42")
+
+	require.Error(t, err)
+	assert.Nil(t, user)
+	assert.Equal(t, "user not found", err.Error())
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/cursor"
+	"testing"
+)
+
+func TestCreateUser_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresUserRepository{Db: sqlxDB}
+
+	mock.ExpectQuery(`^INSERT INTO users \(username\) VALUES \(\$1\) RETURNING id$`).
+		WithArgs("Anna").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+	user, err := repo.CreateUser(context.Background(), model.NewUser{Username: "Anna"})
+
+	require.NoError(t, err)
+	assert.Equal(t, &model.User{ID: "4", Username: "Anna"}, user)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestCreateUser_UsernameTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresUserRepository{Db: sqlxDB}
+
+	mock.ExpectQuery(`^INSERT INTO users`).
+		WithArgs("maxim").
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	user, err := repo.CreateUser(context.Background(), model.NewUser{Username: "maxim"})
+
+	require.Error(t, err)
+	assert.Nil(t, user)
+	assert.Equal(t, "username already taken", err.Error())
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestUserByUsername_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresUserRepository{Db: sqlxDB}
+
+	mock.ExpectQuery(`WHERE LOWER\(username\) = LOWER\(\$1\)`).
+		WithArgs("nobody").
+		WillReturnError(sql.ErrNoRows)
+
+	user, err := repo.UserByUsername(context.Background(), "nobody")
+
+	require.Error(t, err)
+	assert.Nil(t, user)
+	assert.Equal(t, "user not found", err.Error())
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+func TestUsers_AfterCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	repo := &repository.PostgresUserRepository{Db: sqlxDB}
+
+	first := 1
+	after := cursor.Encode("", "1")
+
+	mock.ExpectQuery(`^SELECT id, username FROM users WHERE id > \$1 ORDER BY id LIMIT \$2$`).
+		WithArgs(1, first+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(2, "Vika").AddRow(3, "Ruslan"))
+
+	connection, err := repo.Users(context.Background(), &first, &after)
+
+	require.NoError(t, err)
+	require.Len(t, connection.Edges, 1)
+	assert.Equal(t, "Vika", connection.Edges[0].Node.Username)
+	assert.True(t, connection.PageInfo.HasNextPage)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
+
+// TestPostgresUsers_NonNumericID: id в базе числовые, и нечисловой id не доходит до запроса,
+// а дает те же ошибки, что и хранилище в памяти, вместо ошибки приведения типа в postgres.
+func TestPostgresUsers_NonNumericID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := &repository.PostgresUserRepository{Db: sqlx.NewDb(db, "postgres")}
+
+	_, err = repo.UserByID(context.Background(), "abc")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	after := cursor.Encode("", "abc")
+	_, err = repo.Users(context.Background(), nil, &after)
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
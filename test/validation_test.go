@@ -0,0 +1,89 @@
+package test
+
+import (
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/apperr"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/internal/validation"
+	"ozon-graphql-api/pkg/memory"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidator_NewPostListsEveryViolation(t *testing.T) {
+	v := validation.New(validation.Config{})
+
+	err := v.NewPost(&model.NewPost{
+		Title: strings.Repeat("t", validation.DefaultMaxTitleLength+1),
+		Text:  "   ",
+	})
+
+	require.ErrorIs(t, err, apperr.Validation)
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "title", Rule: validation.RuleMaxLength, Message: "should not exceed 255 characters"},
+		{Field: "text", Rule: validation.RuleRequired, Message: "should not be empty"},
+	}, apperr.FieldsOf(err))
+	assert.Equal(t, "invalid input: title: should not exceed 255 characters; text: should not be empty", err.Error())
+}
+
+func TestValidator_NewPostDefaultsCommenting(t *testing.T) {
+	v := validation.New(validation.Config{})
+
+	input := model.NewPost{Title: "Title", Text: "Text"}
+	require.NoError(t, v.NewPost(&input))
+
+	require.NotNil(t, input.IsCommentingAvailable)
+	assert.True(t, *input.IsCommentingAvailable)
+}
+
+func TestValidator_CommentLengthCountsRunes(t *testing.T) {
+	v := validation.New(validation.Config{MaxCommentLength: 5})
+
+	assert.NoError(t, v.NewComment(model.NewComment{PostID: "1", Text: "приве"}))
+	assert.NoError(t, v.UpdateComment("héllo"))
+
+	err := v.NewComment(model.NewComment{PostID: "1", Text: "привет"})
+	require.Error(t, err)
+	assert.Equal(t, []apperr.FieldError{
+		{Field: "text", Rule: validation.RuleMaxLength, Message: "should not exceed 5 characters"},
+	}, apperr.FieldsOf(err))
+}
+
+func TestValidator_NewCommentRequiredFields(t *testing.T) {
+	v := validation.New(validation.Config{})
+
+	empty := ""
+	err := v.NewComment(model.NewComment{ReplyTo: &empty})
+
+	var fields []string
+	for _, field := range apperr.FieldsOf(err) {
+		fields = append(fields, field.Field)
+	}
+	assert.Equal(t, []string{"postID", "replyTo", "text"}, fields)
+}
+
+func TestValidator_UpdatePostChecksOnlyGivenFields(t *testing.T) {
+	v := validation.New(validation.Config{MaxPostLength: 3})
+
+	assert.NoError(t, v.UpdatePost(model.UpdatePost{}))
+
+	text := "long"
+	err := v.UpdatePost(model.UpdatePost{Text: &text})
+	require.Len(t, apperr.FieldsOf(err), 1)
+	assert.Equal(t, "text", apperr.FieldsOf(err)[0].Field)
+}
+
+func TestErrorPresenter_ValidationFields(t *testing.T) {
+	repos := repository.NewMemoryRepository(memory.NewStorage())
+
+	response := doPresentedQuery(t, repos, `mutation { createUser(input: {username: " "}) { id } }`)
+
+	require.Len(t, response.Errors, 1)
+	assert.Equal(t, string(apperr.Validation), response.Errors[0].Extensions["code"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"field": "username", "rule": "required", "message": "should not be empty"},
+	}, response.Errors[0].Extensions["fields"])
+}
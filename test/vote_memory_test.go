@@ -0,0 +1,139 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"ozon-graphql-api/pkg/memory"
+	"path/filepath"
+	"testing"
+)
+
+func newVoteStorage() *memory.Storage {
+	storage := memory.NewStorage()
+
+	storage.PutPost(&model.Post{
+		ID:        "1",
+		Title:     "Post",
+		CreatedBy: &model.User{ID: "1"},
+	})
+	storage.PutComment(&model.Comment{
+		ID:     "1",
+		PostID: "1",
+		Sender: &model.User{ID: "1"},
+	})
+
+	return storage
+}
+
+func TestMemoryVote_ChangeAndRetract(t *testing.T) {
+	storage := newVoteStorage()
+	repo := repository.NewMemoryVoteRepo(storage)
+	ctx := context.Background()
+
+	result, err := repo.Vote(ctx, model.VoteTargetPost, "1", "2", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Score)
+	assert.Equal(t, 1, result.Upvotes)
+	assert.Equal(t, 1, result.MyVote)
+
+	_, err = repo.Vote(ctx, model.VoteTargetPost, "1", "3", 1)
+	require.NoError(t, err)
+
+	//Повторный голос пользователя заменяет предыдущий
+	result, err = repo.Vote(ctx, model.VoteTargetPost, "1", "2", -1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Score)
+	assert.Equal(t, 1, result.Upvotes)
+	assert.Equal(t, 1, result.Downvotes)
+
+	result, err = repo.Vote(ctx, model.VoteTargetPost, "1", "2", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Score)
+	assert.Equal(t, 0, result.Downvotes)
+	assert.Equal(t, 0, result.MyVote)
+
+	assert.Equal(t, 1, storage.Posts["1"].Upvotes)
+	assert.Equal(t, 0, storage.Posts["1"].Downvotes)
+
+	myVote, err := repo.MyVote(ctx, model.VoteTargetPost, "1", "2")
+	require.NoError(t, err)
+	assert.Equal(t, 0, myVote)
+
+	myVote, err = repo.MyVote(ctx, model.VoteTargetPost, "1", "3")
+	require.NoError(t, err)
+	assert.Equal(t, 1, myVote)
+}
+
+func TestMemoryVote_Comment(t *testing.T) {
+	storage := newVoteStorage()
+	repo := repository.NewMemoryVoteRepo(storage)
+
+	result, err := repo.Vote(context.Background(), model.VoteTargetComment, "1", "2", -1)
+	require.NoError(t, err)
+	assert.Equal(t, -1, result.Score)
+	assert.Equal(t, 1, storage.Comments["1"].Downvotes)
+	assert.Equal(t, 0, storage.Posts["1"].Downvotes)
+}
+
+func TestMemoryVote_NotFound(t *testing.T) {
+	repo := repository.NewMemoryVoteRepo(newVoteStorage())
+
+	_, err := repo.Vote(context.Background(), model.VoteTargetComment, "42", "2", 1)
+	require.EqualError(t, err, "comment not found")
+}
+
+func TestMemoryVote_Deleted(t *testing.T) {
+	storage := newVoteStorage()
+	deletedAt := ts("2024-09-09T12:34:56Z")
+	storage.Posts["1"].DeletedAt = &deletedAt
+
+	repo := repository.NewMemoryVoteRepo(storage)
+
+	_, err := repo.Vote(context.Background(), model.VoteTargetPost, "1", "2", 1)
+	require.Error(t, err)
+	assert.Equal(t, 0, storage.Posts["1"].Upvotes)
+}
+
+// TestMemoryDelete_DropsVotes: голоса удаленной записи удаляются вместе с ней, как ON DELETE CASCADE
+// в базе, и не воскресают при воспроизведении журнала.
+func TestMemoryDelete_DropsVotes(t *testing.T) {
+	dir := t.TempDir()
+	storage := journaledStorage(t, dir, 0)
+	repos := repository.NewMemoryRepository(storage)
+	ctx := context.Background()
+
+	post, err := repos.CreatePost(ctx, model.NewPost{Title: "Title", Text: "Text", UserID: "1"})
+	require.NoError(t, err)
+	comment, err := repos.CreateComment(ctx, model.NewComment{PostID: post.ID, SenderID: "1", Text: "Comment"}, anyComment)
+	require.NoError(t, err)
+
+	_, err = repos.Vote(ctx, model.VoteTargetPost, post.ID, "2", 1)
+	require.NoError(t, err)
+	_, err = repos.Vote(ctx, model.VoteTargetComment, comment.ID, "2", -1)
+	require.NoError(t, err)
+	require.Contains(t, storage.Votes, memory.PostKey(post.ID))
+	require.Contains(t, storage.Votes, memory.CommentKey(comment.ID))
+
+	require.NoError(t, repos.DeleteComment(ctx, comment.ID, "1"))
+	assert.NotContains(t, storage.Votes, memory.CommentKey(comment.ID))
+	require.NoError(t, repos.DeletePost(ctx, post.ID, "1"))
+	assert.NotContains(t, storage.Votes, memory.PostKey(post.ID))
+	require.NoError(t, storage.Journal.Close())
+
+	restored, err := memory.LoadFromFile(filepath.Join(dir, "storage.json"), filepath.Join(dir, "storage.journal"))
+	require.NoError(t, err)
+	assert.Empty(t, restored.Votes)
+}
+
+func TestMemoryVote_UnknownUser(t *testing.T) {
+	storage := newVoteStorage()
+	repo := repository.NewMemoryVoteRepo(storage)
+
+	_, err := repo.Vote(context.Background(), model.VoteTargetPost, "1", "auth0|abc", 1)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	assert.Equal(t, 0, storage.Posts["1"].Upvotes)
+	assert.Empty(t, storage.Votes)
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"ozon-graphql-api/graph/model"
+	"ozon-graphql-api/internal/repository"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVote_ChangeVote(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresVoteRepo(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT deletedAt FROM posts WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"deletedAt"}).AddRow(nil))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM users WHERE id = \\$1\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT value FROM votes WHERE userId = \\$1 AND postId = \\$2").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+	mock.ExpectExec("UPDATE votes SET value = \\$3").
+		WithArgs(2, 1, -1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE posts SET upvotes = upvotes \\+ \\$2, downvotes = downvotes \\+ \\$3").
+		WithArgs(1, -1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"upvotes", "downvotes"}).AddRow(4, 2))
+	mock.ExpectCommit()
+
+	result, err := repo.Vote(context.Background(), model.VoteTargetPost, "1", "2", -1)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.Score)
+	assert.Equal(t, 4, result.Upvotes)
+	assert.Equal(t, 2, result.Downvotes)
+	assert.Equal(t, -1, result.MyVote)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVote_Retract(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresVoteRepo(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT deletedAt FROM comments").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"deletedAt"}).AddRow(nil))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM users WHERE id = \\$1\\)").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT value FROM votes WHERE userId = \\$1 AND commentId = \\$2").
+		WithArgs(2, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM votes").
+		WithArgs(2, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE comments SET upvotes").
+		WithArgs(5, -1, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"upvotes", "downvotes"}).AddRow(0, 0))
+	mock.ExpectCommit()
+
+	result, err := repo.Vote(context.Background(), model.VoteTargetComment, "5", "2", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Score)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVote_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresVoteRepo(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT deletedAt FROM posts").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err = repo.Vote(context.Background(), model.VoteTargetPost, "1", "2", 1)
+	require.EqualError(t, err, "post not found")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVote_UnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewPostgresVoteRepo(sqlx.NewDb(db, "postgres"))
+
+	//Снятие голоса ничего не пишет, и внешний ключ бы не сработал
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT deletedAt FROM posts").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"deletedAt"}).AddRow(nil))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM users WHERE id = \\$1\\)").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	_, err = repo.Vote(context.Background(), model.VoteTargetPost, "1", "9", 0)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	//Нечисловой sub из токена не доходит до базы
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT deletedAt FROM posts").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"deletedAt"}).AddRow(nil))
+	mock.ExpectRollback()
+
+	_, err = repo.Vote(context.Background(), model.VoteTargetPost, "1", "auth0|abc", 1)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	vote, err := repo.MyVote(context.Background(), model.VoteTargetPost, "1", "auth0|abc")
+	require.NoError(t, err)
+	assert.Equal(t, 0, vote)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}